@@ -0,0 +1,229 @@
+package xlsx
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Options for reading a sheet from CSV
+type CSVOptions struct {
+	// Field delimiter, ',' when zero
+	Comma rune
+
+	// Layouts, as for time.Parse, tried in order to read dates. The
+	// DefaultDateLayouts are used when empty.
+	DateLayouts []string
+}
+
+// Date layouts recognised by FromCSV when no others are given
+var DefaultDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Read a sheet from CSV. The first record holds the column names. A column
+// whose non-empty values all parse as numbers holds number cells, which keep
+// the text of the CSV as their value; a value with a leading zero, such as
+// the ZIP code "00501", is not a number. A column whose values all parse as
+// dates holds date cells, and any other column holds strings. Dates without
+// a time of day are shown as dates only. Empty values are left as empty
+// cells. The column widths fit their contents.
+func FromCSV(r io.Reader, opts CSVOptions) (*Sheet, error) {
+	cr := csv.NewReader(r)
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the CSV has no header record")
+	}
+
+	layouts := opts.DateLayouts
+	if len(layouts) == 0 {
+		layouts = DefaultDateLayouts
+	}
+
+	header, data := records[0], records[1:]
+
+	columns := make([]Column, len(header))
+	for i, name := range header {
+		columns[i] = Column{Name: name, Type: csvColumnType(data, i, layouts)}
+	}
+
+	s := NewSheetWithColumns(columns)
+	s.AutoWidth = true
+
+	titles := s.NewRow()
+	for i, name := range header {
+		titles.Cells[i] = NewStringCell(name)
+	}
+	err = s.AppendRow(titles)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range data {
+		r := s.NewRow()
+		for i, v := range record {
+			if v == "" {
+				continue
+			}
+
+			switch columns[i].Type {
+			case CellTypeNumber:
+				r.Cells[i] = Cell{Type: CellTypeNumber, Value: v}
+			case CellTypeDatetime, CellTypeDate:
+				t, _ := parseCSVDate(v, layouts)
+				r.Cells[i] = NewDateCell(t)
+				r.Cells[i].Type = columns[i].Type
+			default:
+				r.Cells[i] = NewStringCell(v)
+			}
+		}
+
+		err = s.AppendRow(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &s, nil
+}
+
+// Write the rows of the sheet as CSV. Shared strings are written as their
+// text, datetimes in RFC3339 form and dates as 2006-01-02, booleans as TRUE
+// or FALSE, formulas as their formula and numbers as they are held. Column
+// names are not written unless the sheet has a row of them.
+func (s *Sheet) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	for y, r := range s.rows {
+		record := make([]string, len(r.Cells))
+		for x, c := range r.Cells {
+			v, err := s.csvValue(c)
+			if err != nil {
+				cellX, cellY := CellIndex(uint64(x), uint64(y))
+				return fmt.Errorf("cell %s%d: %s", cellX, cellY, err.Error())
+			}
+			record[x] = v
+		}
+
+		err := cw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// The text of a cell as written by WriteCSV
+func (s *Sheet) csvValue(c Cell) (string, error) {
+	switch c.Type {
+	case CellTypeString:
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(s.sharedStrings) {
+			return "", fmt.Errorf("invalid shared string reference %q", c.Value)
+		}
+		return html.UnescapeString(s.sharedStrings[i]), nil
+	case CellTypeBool:
+		if c.Value == "1" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case CellTypeDatetime, CellTypeDate:
+		t := c.Time
+		if t.IsZero() {
+			if c.Type == CellTypeDatetime {
+				return c.Value, nil
+			}
+			var err error
+			t, err = time.Parse(time.RFC3339, c.Value)
+			if err != nil {
+				return "", fmt.Errorf("invalid date %q", c.Value)
+			}
+		}
+		if c.Type == CellTypeDate {
+			return t.Format("2006-01-02"), nil
+		}
+		return t.Format(time.RFC3339), nil
+	}
+
+	return c.Value, nil
+}
+
+// The type of cells of column i of the records: CellTypeNumber or
+// CellTypeDatetime, or CellTypeDate when no date has a time of day, if every
+// non-empty value parses as such and CellTypeString otherwise
+func csvColumnType(records [][]string, i int, layouts []string) CellType {
+	numbers, dates, times := true, true, false
+	values := 0
+
+	for _, record := range records {
+		v := record[i]
+		if v == "" {
+			continue
+		}
+		values++
+
+		if numbers {
+			_, err := parseCSVNumber(v)
+			numbers = err == nil
+		}
+		if dates {
+			t, err := parseCSVDate(v, layouts)
+			dates = err == nil
+			if t.Hour() != 0 || t.Minute() != 0 || t.Second() != 0 || t.Nanosecond() != 0 {
+				times = true
+			}
+		}
+	}
+
+	switch {
+	case values == 0:
+		return CellTypeString
+	case numbers:
+		return CellTypeNumber
+	case dates && times:
+		return CellTypeDatetime
+	case dates:
+		return CellTypeDate
+	}
+	return CellTypeString
+}
+
+var leadingZero = regexp.MustCompile(`^[-+]?0[0-9]`)
+
+// Parse a finite decimal number without leading zeros
+func parseCSVNumber(v string) (float64, error) {
+	if leadingZero.MatchString(v) {
+		return 0, errors.New("the number has a leading zero")
+	}
+	return parseDecimal(v)
+}
+
+// Parse a date with the first of the layouts which fits it
+func parseCSVDate(v string, layouts []string) (time.Time, error) {
+	var err error
+	for _, layout := range layouts {
+		var t time.Time
+		t, err = time.Parse(layout, v)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
@@ -48,7 +48,7 @@ func WriteStreaming() error {
 			Value: "Test",
 		}
 
-		err = sw.WriteRows([]xlsx.Row{r})
+		err = sw.WriteRow(r)
 	}
 
 	err = ww.Close()
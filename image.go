@@ -0,0 +1,184 @@
+package xlsx
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"sort"
+	"strconv"
+)
+
+// Encoding of an image added to a sheet
+type ImageFormat uint
+
+const (
+	ImagePNG ImageFormat = iota
+	ImageJPEG
+)
+
+// The file extension of the image format
+func (f ImageFormat) Extension() string {
+	if f == ImageJPEG {
+		return "jpeg"
+	}
+	return "png"
+}
+
+// The MIME type of the image format
+func (f ImageFormat) ContentType() string {
+	return "image/" + f.Extension()
+}
+
+// Number of English Metric Units in a pixel at 96 dpi
+const emuPerPixel = 9525
+
+// An image placed on a sheet, either with its top-left corner in a cell or
+// at an absolute position
+type sheetImage struct {
+	data   []byte
+	format ImageFormat
+	size   image.Config
+
+	// the anchor cell, or an empty cell for an absolute position
+	cell       string
+	col, row   uint64
+	posX, posY int
+}
+
+// Add an image with its top-left corner in the given cell, for example "B2".
+// The image is shown at its own size.
+func (s *Sheet) AddImage(cell string, data []byte, format ImageFormat) error {
+	col, row, err := parseCellRef(cell)
+	if err != nil {
+		return err
+	}
+
+	img, err := newSheetImage(data, format)
+	if err != nil {
+		return err
+	}
+	img.cell = cell
+	img.col = col
+	img.row = row
+
+	s.images = append(s.images, img)
+
+	return nil
+}
+
+// Add an image with its top-left corner at the given position in pixels from
+// the top-left of the sheet. The image is shown at its own size.
+func (s *Sheet) AddImageAt(x, y int, data []byte, format ImageFormat) error {
+	if x < 0 || y < 0 {
+		return fmt.Errorf("invalid image position %d, %d", x, y)
+	}
+
+	img, err := newSheetImage(data, format)
+	if err != nil {
+		return err
+	}
+	img.posX = x
+	img.posY = y
+
+	s.images = append(s.images, img)
+
+	return nil
+}
+
+// Check that the data is an image in the given format and read its size
+func newSheetImage(data []byte, format ImageFormat) (sheetImage, error) {
+	var size image.Config
+	var err error
+
+	switch format {
+	case ImagePNG:
+		size, err = png.DecodeConfig(bytes.NewReader(data))
+	case ImageJPEG:
+		size, err = jpeg.DecodeConfig(bytes.NewReader(data))
+	default:
+		return sheetImage{}, fmt.Errorf("invalid image format %d", format)
+	}
+	if err != nil {
+		return sheetImage{}, fmt.Errorf("invalid %s image: %s", format.Extension(), err.Error())
+	}
+
+	return sheetImage{data: data, format: format, size: size}, nil
+}
+
+// Image as written to the drawing XML of a sheet
+type drawingImage struct {
+	Absolute      bool
+	Col, Row      uint64
+	X, Y          int
+	Width, Height int
+	Name          string
+}
+
+// Write the images of the sheet to the workbook as a drawing, its
+// relationships and the media files, and relate the drawing to the sheet
+func (sw *SheetWriter) writeImages() error {
+	images := sw.sheet.images
+	if len(images) == 0 {
+		return nil
+	}
+
+	ww := sw.ww
+	ww.drawings = append(ww.drawings, len(ww.drawings)+1)
+	drawing := strconv.Itoa(len(ww.drawings))
+
+	data := make([]drawingImage, len(images))
+	for i, img := range images {
+		ww.mediaCount++
+		if ww.mediaTypes == nil {
+			ww.mediaTypes = make(map[ImageFormat]bool)
+		}
+		ww.mediaTypes[img.format] = true
+
+		d := drawingImage{
+			Absolute: img.cell == "",
+			Col:      img.col,
+			Row:      img.row,
+			X:        img.posX * emuPerPixel,
+			Y:        img.posY * emuPerPixel,
+			Width:    img.size.Width * emuPerPixel,
+			Height:   img.size.Height * emuPerPixel,
+			Name:     "image" + strconv.Itoa(ww.mediaCount) + "." + img.format.Extension(),
+		}
+		data[i] = d
+
+		f, err := ww.createPart("xl/media/" + d.Name)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(img.data)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := ww.writePart("xl/drawings/drawing"+drawing+".xml", TemplateDrawing, data)
+	if err != nil {
+		return err
+	}
+
+	err = ww.writePart("xl/drawings/_rels/drawing"+drawing+".xml.rels", TemplateDrawingRelationships, data)
+	if err != nil {
+		return err
+	}
+
+	sheet := sw.partName[len("xl/worksheets/"):]
+	return ww.writePart("xl/worksheets/_rels/"+sheet+".rels", TemplateSheetRelationships, "../drawings/drawing"+drawing+".xml")
+}
+
+// File extensions and content types of the images in the workbook
+func (ww *WorkbookWriter) imageTypes() []ImageFormat {
+	formats := make([]ImageFormat, 0, len(ww.mediaTypes))
+	for f := range ww.mediaTypes {
+		formats = append(formats, f)
+	}
+	sort.Slice(formats, func(i, j int) bool { return formats[i] < formats[j] })
+
+	return formats
+}
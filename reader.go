@@ -0,0 +1,622 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Open the XLSX file and read its first sheet
+func OpenFile(filename string) (*Sheet, error) {
+	z, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	return readSheet(&z.Reader)
+}
+
+// Read the first sheet of the XLSX file from the given reader. Numbers,
+// booleans, shared and inline strings are read, as are dates and percentages,
+// which are recognised by the number format of their cell. Formulas are read with
+// their cached results.
+func ReadSheet(r io.Reader) (*Sheet, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	return readSheet(z)
+}
+
+// Open the XLSX file to append rows to its first sheet. The rows already in
+// the sheet are written to a new file, and the returned SheetWriter is
+// positioned after them; the new file replaces filename when the returned
+// WorkbookWriter is closed, and is removed instead if closing fails.
+//
+// Only what ReadSheet reads is kept: the title, column widths, row heights
+// and cell values of the first sheet, dates in the datetime format, and the
+// document properties. A workbook holding anything else which would be lost,
+// such as a second sheet, merged cells, images or cells with fonts, fills or
+// borders, is left unchanged and an error is returned. The dimension and shared strings are rewritten to cover the appended rows,
+// so string cells may be appended as CellTypeString or CellTypeInlineString.
+// The rows of the sheet are held in a temporary file until it is closed, as
+// with the WorkbookWriter's BackfillDimension.
+func OpenForAppend(filename string) (*WorkbookWriter, *SheetWriter, error) {
+	z, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = checkAppendable(&z.Reader)
+	var s *Sheet
+	if err == nil {
+		s, err = readSheet(&z.Reader)
+	}
+	z.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.DocumentInfo.ModifiedAt = time.Now()
+
+	f, err := ioutil.TempFile(filepath.Dir(filename), "xlsx-append")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ww := NewWorkbookWriter(f)
+	ww.BackfillDimension = true
+	ww.appendFile = f
+	ww.appendTo = filename
+
+	sw, err := ww.NewSheetWriter(s)
+	if err == nil {
+		err = sw.WriteRows(s.rows)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, nil, err
+	}
+
+	return ww, sw, nil
+}
+
+// Replace the file opened by OpenForAppend with the new file, unless err
+// shows that writing it failed
+func (ww *WorkbookWriter) replaceAppended(err error) error {
+	name := ww.appendFile.Name()
+
+	cerr := ww.appendFile.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(name, ww.appendTo)
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+
+	return err
+}
+
+// XML structure of the parts of a workbook which are read
+type xmlWorkbook struct {
+	Properties struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xmlRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xmlText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+// The text of a string item, joining any rich text runs
+func (t xmlText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+
+	s := ""
+	for _, r := range t.Runs {
+		s += r.T
+	}
+	return s
+}
+
+type xmlSharedStrings struct {
+	Items []xmlText `xml:"si"`
+}
+
+type xmlStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	Fonts []struct {
+		Bold      *struct{} `xml:"b"`
+		Italic    *struct{} `xml:"i"`
+		Underline *struct{} `xml:"u"`
+	} `xml:"fonts>font"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+		FontID   int `xml:"fontId,attr"`
+		FillID   int `xml:"fillId,attr"`
+		BorderID int `xml:"borderId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xmlWorksheet struct {
+	Cols []struct {
+		Min    int     `xml:"min,attr"`
+		Max    int     `xml:"max,attr"`
+		Width  float64 `xml:"width,attr"`
+		Hidden bool    `xml:"hidden,attr"`
+	} `xml:"cols>col"`
+	Rows []struct {
+		R      int     `xml:"r,attr"`
+		Height float64 `xml:"ht,attr"`
+		Cells  []struct {
+			R  string   `xml:"r,attr"`
+			T  string   `xml:"t,attr"`
+			S  int      `xml:"s,attr"`
+			F  *string  `xml:"f"`
+			V  *string  `xml:"v"`
+			Is *xmlText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+type xmlCore struct {
+	Creator        string `xml:"creator"`
+	LastModifiedBy string `xml:"lastModifiedBy"`
+	Created        string `xml:"created"`
+	Modified       string `xml:"modified"`
+	Title          string `xml:"title"`
+	Subject        string `xml:"subject"`
+	Keywords       string `xml:"keywords"`
+	Description    string `xml:"description"`
+	Category       string `xml:"category"`
+}
+
+type xmlApp struct {
+	Application string `xml:"Application"`
+	Company     string `xml:"Company"`
+	Manager     string `xml:"Manager"`
+}
+
+// Decode the named part of the zip file into v, returning false if the part
+// does not exist
+func readPart(z *zip.Reader, name string, v interface{}) (bool, error) {
+	for _, f := range z.File {
+		if f.Name != name {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return true, err
+		}
+		defer r.Close()
+
+		return true, xml.NewDecoder(r).Decode(v)
+	}
+
+	return false, nil
+}
+
+// Read the workbook part of the zip file and find the part of its first
+// sheet
+func readWorkbook(z *zip.Reader) (xmlWorkbook, string, error) {
+	var wb xmlWorkbook
+	found, err := readPart(z, "xl/workbook.xml", &wb)
+	if err != nil {
+		return wb, "", err
+	}
+	if !found || len(wb.Sheets) == 0 {
+		return wb, "", fmt.Errorf("the file does not contain a workbook with sheets")
+	}
+
+	var rels xmlRelationships
+	_, err = readPart(z, "xl/_rels/workbook.xml.rels", &rels)
+	if err != nil {
+		return wb, "", err
+	}
+
+	sheetPart := ""
+	for _, r := range rels.Relationships {
+		if r.ID == wb.Sheets[0].ID {
+			sheetPart = path.Join("xl", r.Target)
+			if strings.HasPrefix(r.Target, "/") {
+				sheetPart = strings.TrimPrefix(r.Target, "/")
+			}
+		}
+	}
+	if sheetPart == "" {
+		return wb, "", fmt.Errorf("no part found for sheet %q", wb.Sheets[0].Name)
+	}
+
+	return wb, sheetPart, nil
+}
+
+// Parts of a workbook which OpenForAppend can not carry over
+var unappendableParts = []string{
+	"xl/worksheets/_rels/",
+	"xl/drawings/",
+	"xl/media/",
+	"xl/charts/",
+	"xl/tables/",
+	"xl/pivotTables/",
+	"xl/pivotCache/",
+	"xl/externalLinks/",
+	"xl/vbaProject.bin",
+}
+
+// Elements of a worksheet which OpenForAppend can not carry over
+type xmlUnappendable struct {
+	MergeCells  []struct{} `xml:"mergeCells>mergeCell"`
+	Conditional []struct{} `xml:"conditionalFormatting"`
+	Validations []struct{} `xml:"dataValidations>dataValidation"`
+	Hyperlinks  []struct{} `xml:"hyperlinks>hyperlink"`
+	Rows        []struct {
+		Cells []struct {
+			R string `xml:"r,attr"`
+			S int    `xml:"s,attr"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// Check that appending to the workbook in the zip file loses nothing but
+// what ReadSheet does not read and the writer writes again, returning an
+// error naming what would be lost otherwise
+func checkAppendable(z *zip.Reader) error {
+	wb, sheetPart, err := readWorkbook(z)
+	if err != nil {
+		return err
+	}
+	if len(wb.Sheets) > 1 {
+		return fmt.Errorf("the workbook has %d sheets and only the first could be kept", len(wb.Sheets))
+	}
+
+	for _, f := range z.File {
+		for _, p := range unappendableParts {
+			if strings.HasPrefix(f.Name, p) {
+				return fmt.Errorf("the workbook part %s could not be kept", f.Name)
+			}
+		}
+	}
+
+	var ws xmlUnappendable
+	_, err = readPart(z, sheetPart, &ws)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(ws.MergeCells) > 0:
+		return fmt.Errorf("the merged cells of sheet %q could not be kept", wb.Sheets[0].Name)
+	case len(ws.Conditional) > 0:
+		return fmt.Errorf("the conditional formatting of sheet %q could not be kept", wb.Sheets[0].Name)
+	case len(ws.Validations) > 0:
+		return fmt.Errorf("the data validation of sheet %q could not be kept", wb.Sheets[0].Name)
+	case len(ws.Hyperlinks) > 0:
+		return fmt.Errorf("the hyperlinks of sheet %q could not be kept", wb.Sheets[0].Name)
+	}
+
+	var styles xmlStyles
+	_, err = readPart(z, "xl/styles.xml", &styles)
+	if err != nil {
+		return err
+	}
+
+	// cells whose fonts, fills or borders would be lost
+	formatted := make(map[int]bool)
+	for i, xf := range styles.CellXfs {
+		formatted[i] = xf.FillID > 1 || xf.BorderID > 0
+		if xf.FontID >= 0 && xf.FontID < len(styles.Fonts) {
+			f := styles.Fonts[xf.FontID]
+			formatted[i] = formatted[i] || f.Bold != nil || f.Italic != nil || f.Underline != nil
+		}
+	}
+	for _, r := range ws.Rows {
+		for _, c := range r.Cells {
+			if formatted[c.S] {
+				return fmt.Errorf("the formatting of cell %s could not be kept", c.R)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Read the first sheet of the workbook in the zip file
+func readSheet(z *zip.Reader) (*Sheet, error) {
+	wb, sheetPart, err := readWorkbook(z)
+	if err != nil {
+		return nil, err
+	}
+
+	date1904 := wb.Properties.Date1904 == "1" || wb.Properties.Date1904 == "true"
+
+	var sst xmlSharedStrings
+	_, err = readPart(z, "xl/sharedStrings.xml", &sst)
+	if err != nil {
+		return nil, err
+	}
+
+	var styles xmlStyles
+	_, err = readPart(z, "xl/styles.xml", &styles)
+	if err != nil {
+		return nil, err
+	}
+
+	dateStyles := make(map[int]bool)
+	dateOnlyStyles := make(map[int]bool)
+	percentStyles := make(map[int]bool)
+	customFormats := make(map[int]string)
+	for _, f := range styles.NumFmts {
+		customFormats[f.ID] = f.Code
+	}
+	for i, xf := range styles.CellXfs {
+		dateStyles[i] = isDateFormat(xf.NumFmtID, customFormats[xf.NumFmtID])
+		dateOnlyStyles[i] = xf.NumFmtID == 14 || customFormats[xf.NumFmtID] == FormatDate
+		percentStyles[i] = xf.NumFmtID == 9 || xf.NumFmtID == 10
+	}
+
+	var ws xmlWorksheet
+	found, err := readPart(z, sheetPart, &ws)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("sheet part %s not found", sheetPart)
+	}
+
+	// cells are collected first, as the number of columns is only known
+	// once every row has been read
+	cells := make(map[uint64]map[uint64]Cell)
+	heights := make(map[uint64]float64)
+	var ncols, nrows uint64
+
+	for i, r := range ws.Rows {
+		y := uint64(i)
+		if r.R > 0 {
+			y = uint64(r.R - 1)
+		} else if nrows > 0 {
+			y = nrows
+		}
+		if y+1 > nrows {
+			nrows = y + 1
+		}
+
+		row := make(map[uint64]Cell)
+		cells[y] = row
+		heights[y] = r.Height
+
+		for j, c := range r.Cells {
+			x := uint64(j)
+			if c.R != "" {
+				x, _, err = parseCellRef(c.R)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if x+1 > ncols {
+				ncols = x + 1
+			}
+
+			v := ""
+			if c.V != nil {
+				v = *c.V
+			}
+
+			var cell Cell
+
+			switch {
+			case c.F != nil:
+				cell = Cell{Type: CellTypeFormula, Value: *c.F, Result: v}
+			case c.T == "s":
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 || n >= len(sst.Items) {
+					return nil, fmt.Errorf("cell %s has an invalid shared string reference %q", c.R, v)
+				}
+				cell = Cell{Type: CellTypeString, Value: sst.Items[n].String()}
+			case c.T == "inlineStr":
+				if c.Is != nil {
+					cell = Cell{Type: CellTypeInlineString, Value: c.Is.String()}
+				} else {
+					cell = Cell{Type: CellTypeInlineString}
+				}
+			case c.T == "str":
+				cell = Cell{Type: CellTypeInlineString, Value: v}
+			case c.T == "b":
+				cell = Cell{Type: CellTypeBool, Value: v}
+			case v == "":
+				continue
+			case dateStyles[c.S]:
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return nil, fmt.Errorf("cell %s has an invalid date value %q", c.R, v)
+				}
+				d := FromOADate(f)
+				if date1904 {
+					d = FromOADate1904(f)
+				}
+				cell = Cell{Type: CellTypeDatetime, Value: d.Format(time.RFC3339)}
+				if dateOnlyStyles[c.S] {
+					cell.Type = CellTypeDate
+				}
+			case percentStyles[c.S]:
+				cell = Cell{Type: CellTypePercent, Value: v}
+			default:
+				cell = Cell{Type: CellTypeNumber, Value: v}
+			}
+
+			row[x] = cell
+		}
+	}
+
+	// column widths apply only to the columns with cells, as <cols> often
+	// runs to the last column of the sheet
+	columns := make([]Column, ncols)
+	for i := range columns {
+		columns[i].Name = colName(uint64(i))
+	}
+	for _, c := range ws.Cols {
+		for i := c.Min; i <= c.Max && i <= len(columns); i++ {
+			if i > 0 {
+				columns[i-1].Width = uint64(math.Ceil(c.Width))
+				columns[i-1].Hidden = c.Hidden
+			}
+		}
+	}
+
+	s := NewSheetWithColumns(columns)
+	s.Title = wb.Sheets[0].Name
+	s.Date1904 = date1904
+
+	var core xmlCore
+	found, err = readPart(z, "docProps/core.xml", &core)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		s.DocumentInfo.CreatedBy = core.Creator
+		s.DocumentInfo.ModifiedBy = core.LastModifiedBy
+		s.DocumentInfo.CreatedAt, _ = time.Parse(time.RFC3339, core.Created)
+		s.DocumentInfo.ModifiedAt, _ = time.Parse(time.RFC3339, core.Modified)
+		s.DocumentInfo.Title = core.Title
+		s.DocumentInfo.Subject = core.Subject
+		s.DocumentInfo.Keywords = core.Keywords
+		s.DocumentInfo.Description = core.Description
+		s.DocumentInfo.Category = core.Category
+	}
+
+	var app xmlApp
+	_, err = readPart(z, "docProps/app.xml", &app)
+	if err != nil {
+		return nil, err
+	}
+	if app.Application != "None" && app.Application != defaultApplication {
+		s.DocumentInfo.Application = app.Application
+	}
+	s.DocumentInfo.Company = app.Company
+	s.DocumentInfo.Manager = app.Manager
+
+	for y := uint64(0); y < nrows; y++ {
+		r := s.NewRow()
+		for x, c := range cells[y] {
+			r.Cells[x] = c
+		}
+		r.Height = heights[y]
+		err = s.AppendRow(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &s, nil
+}
+
+var cellRefParts = regexp.MustCompile(`^\$?([A-Za-z]{1,3})\$?([0-9]+)$`)
+
+// Parse an Excel cell reference into zero-based column and row indices. For
+// example "A1" => (0,0); "AA46" => (26,45)
+func parseCellRef(ref string) (uint64, uint64, error) {
+	m := cellRefParts.FindStringSubmatch(ref)
+	if m == nil {
+		return 0, 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+
+	var x uint64
+	for _, c := range strings.ToUpper(m[1]) {
+		x = x*26 + uint64(c-'A'+1)
+	}
+
+	y, err := strconv.ParseUint(m[2], 10, 64)
+	if err != nil || y == 0 {
+		return 0, 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+
+	return x - 1, y - 1, nil
+}
+
+var dateFormatCode = regexp.MustCompile(`[dmyhs]`)
+var formatLiterals = regexp.MustCompile(`"[^"]*"|\[[^\]]*\]|\\.`)
+
+// Report whether the number format displays a date. Built-in formats 14 to
+// 22 and 45 to 47 are dates and times; custom formats are dates when they
+// contain date or time codes outside of quoted text and colour or locale
+// brackets.
+func isDateFormat(id int, code string) bool {
+	if (id >= 14 && id <= 22) || (id >= 45 && id <= 47) {
+		return true
+	}
+
+	if code == "" {
+		return false
+	}
+
+	code = formatLiterals.ReplaceAllString(code, "")
+
+	return dateFormatCode.MatchString(strings.ToLower(code))
+}
+
+// Convert an OLE Automation date to a time in UTC. This is the inverse of
+// OADate for times in UTC. As Excel dates have no time zone, the wall clock
+// time of the date can be placed in another location with time.Date.
+func FromOADate(v float64) time.Time {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	nsPerDay := float64(24 * time.Hour)
+
+	// the time of day of a date before the epoch counts forward from the
+	// start of the day
+	if v < 0 {
+		days := math.Ceil(v)
+		v = days + (days - v)
+	}
+
+	// whole days are added separately, as a time.Duration only spans
+	// about 292 years
+	days := math.Floor(v)
+	d := epoch.AddDate(0, 0, int(days)).Add(time.Duration(math.Round((v - days) * nsPerDay)))
+
+	return d.Round(time.Second)
+}
+
+// Convert a date of the 1904 date system to a time in UTC. This is the inverse
+// of OADate1904.
+func FromOADate1904(v float64) time.Time {
+	// the 1904 epoch is 1462 days after the OLE Automation epoch
+	return FromOADate(v + 1462)
+}
@@ -16,8 +16,12 @@ var (
 	TemplateStyles                *template.Template
 	TemplateStringLookups         *template.Template
 	TemplateSheetStart            *template.Template
+	TemplateSheetEnd              *template.Template
 	TemplateApp                   *template.Template
 	TemplateCore                  *template.Template
+	TemplateDrawing               *template.Template
+	TemplateDrawingRelationships  *template.Template
+	TemplateSheetRelationships    *template.Template
 )
 
 // Template function for integer addition. This is useful to convert between
@@ -42,17 +46,31 @@ func init() {
 	TemplateStyles = template.Must(template.New("templateStyles").Funcs(funcMap).Parse(re.ReplaceAllLiteralString(templateStyles, "")))
 	TemplateStringLookups = template.Must(template.New("templateStringLookups").Funcs(funcMap).Parse(re.ReplaceAllLiteralString(templateStringLookups, "")))
 	TemplateSheetStart = template.Must(template.New("templateSheetStart").Funcs(funcMap).Parse(re.ReplaceAllLiteralString(templateSheetStart, "")))
+	TemplateSheetEnd = template.Must(template.New("templateSheetEnd").Funcs(funcMap).Parse(re.ReplaceAllLiteralString(templateSheetEnd, "")))
 	TemplateApp = template.Must(template.New("templateApp").Funcs(funcMap).Parse(re.ReplaceAllLiteralString(templateApp, "")))
 	TemplateCore = template.Must(template.New("templateCore").Funcs(funcMap).Parse(re.ReplaceAllLiteralString(templateCore, "")))
+	TemplateDrawing = template.Must(template.New("templateDrawing").Funcs(funcMap).Parse(re.ReplaceAllLiteralString(templateDrawing, "")))
+	TemplateDrawingRelationships = template.Must(template.New("templateDrawingRelationships").Funcs(funcMap).Parse(re.ReplaceAllLiteralString(templateDrawingRelationships, "")))
+	TemplateSheetRelationships = template.Must(template.New("templateSheetRelationships").Funcs(funcMap).Parse(re.ReplaceAllLiteralString(templateSheetRelationships, "")))
 }
 
 const templateContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
   <Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
       <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
       <Default Extension="xml" ContentType="application/xml"/>
+      {{range .ImageTypes}}
+      <Default Extension="{{.Extension}}" ContentType="{{.ContentType}}"/>
+      {{end}}
       <Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
-      <Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+      {{range $i, $e := .Sheets}}
+      <Override PartName="/xl/worksheets/sheet{{plus $i 1}}.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+      {{end}}
+      {{range .Drawings}}
+      <Override PartName="/xl/drawings/drawing{{.}}.xml" ContentType="application/vnd.openxmlformats-officedocument.drawing+xml"/>
+      {{end}}
+      {{if not .OmitStyles}}
       <Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+      {{end}}
       <Override PartName="/xl/sharedStrings.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sharedStrings+xml"/>
       <Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>
       <Override PartName="/docProps/app.xml" ContentType="application/vnd.openxmlformats-officedocument.extended-properties+xml"/>
@@ -68,43 +86,68 @@ const templateRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="
 const templateWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
   <workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
       <fileVersion appName="xl" lastEdited="5" lowestEdited="5" rupBuild="9303"/>
-      <workbookPr defaultThemeVersion="124226"/>
+      <workbookPr{{if .Date1904}} date1904="1"{{end}} defaultThemeVersion="124226"/>
       <bookViews>
-          <workbookView xWindow="480" yWindow="60" windowWidth="18195" windowHeight="8505"/>
+          <workbookView xWindow="480" yWindow="60" windowWidth="18195" windowHeight="8505"{{if .FirstSheet}} firstSheet="{{.FirstSheet}}"{{end}}{{if .ActiveTab}} activeTab="{{.ActiveTab}}"{{end}}/>
       </bookViews>
       <sheets>
-          <sheet name="{{.Title}}" sheetId="1" r:id="rId1"/>
+          {{range $i, $e := .Sheets}}
+          <sheet name="{{html $e.Title}}" sheetId="{{plus $i 1}}"{{if $e.State}} state="{{$e.State}}"{{end}} r:id="rId{{plus $i 1}}"/>
+          {{end}}
       </sheets>
+      {{if .DefinedNames}}
+      <definedNames>
+          {{range .DefinedNames}}
+          <definedName name="{{.Name}}"{{if .Scoped}} localSheetId="{{.SheetIndex}}"{{end}}>{{.RefersTo}}</definedName>
+          {{end}}
+      </definedNames>
+      {{end}}
       <calcPr calcId="145621"/>
   </workbook>`
 
 const templateWorkbookRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
   <Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
-      <Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
-      <Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>
-      <Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+      {{range $i, $e := .Sheets}}
+      <Relationship Id="rId{{plus $i 1}}" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet{{plus $i 1}}.xml"/>
+      {{end}}
+      <Relationship Id="rId{{plus (len .Sheets) 1}}" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>
+      {{if not .OmitStyles}}
+      <Relationship Id="rId{{plus (len .Sheets) 2}}" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+      {{end}}
   </Relationships>`
 
 const templateStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
-  <styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006" mc:Ignorable="x14ac" xmlns:x14ac="http://schemas.microsoft.com/office/spreadsheetml/2009/9/ac">
-    <numFmts count="3">
+  <styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"{{if not .OmitExtensions}} xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006" mc:Ignorable="x14ac" xmlns:x14ac="http://schemas.microsoft.com/office/spreadsheetml/2009/9/ac"{{end}}>
+    <numFmts count="{{plus (len .NumFmts) 3}}">
       <numFmt numFmtId="43" formatCode="_-* #,##0.00_-;\-* #,##0.00_-;_-* &quot;-&quot;??_-;_-@_-"/>
       <numFmt numFmtId="164" formatCode="yyyy\-mm\-dd\ hh:mm"/>
       <numFmt numFmtId="165" formatCode="yyyy\-mm\-dd;@"/>
+      {{range .NumFmts}}
+      <numFmt numFmtId="{{.ID}}" formatCode="{{html .Code}}"/>
+      {{end}}
     </numFmts>
-    <fonts count="2" x14ac:knownFonts="1">
+    <fonts count="{{plus (len .Fonts) 3}}"{{if not .OmitExtensions}} x14ac:knownFonts="1"{{end}}>
       <font><sz val="11"/><color rgb="FF000000"/><name val="Calibri"/><family val="2"/><scheme val="minor"/></font>
       <font><sz val="11"/><color rgb="FF000000"/><name val="Arial Unicode MS"/></font>
+      <font><b/><sz val="11"/><color rgb="FF000000"/><name val="Arial Unicode MS"/></font>
+      {{range .Fonts}}
+      <font>{{if .Bold}}<b/>{{end}}{{if .Italic}}<i/>{{end}}<sz val="{{.Size}}"/><color rgb="{{html .Color}}"/><name val="{{html .Name}}"/></font>
+      {{end}}
     </fonts>
-    <fills count="2">
+    <fills count="{{plus (len .Fills) 2}}">
       <fill>
         <patternFill patternType="none"/>
       </fill>
       <fill>
         <patternFill patternType="gray125"/>
       </fill>
+      {{range .Fills}}
+      <fill>
+        <patternFill patternType="solid"><fgColor rgb="{{.}}"/><bgColor indexed="64"/></patternFill>
+      </fill>
+      {{end}}
     </fills>
-    <borders count="1">
+    <borders count="2">
       <border>
         <left/>
         <right/>
@@ -112,45 +155,209 @@ const templateStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
         <bottom/>
         <diagonal/>
       </border>
+      <border>
+        <left/>
+        <right/>
+        <top style="thin"><color auto="1"/></top>
+        <bottom/>
+        <diagonal/>
+      </border>
     </borders>
     <cellStyleXfs count="1">
       <xf numFmtId="0" fontId="0" fillId="0" borderId="0"/>
     </cellStyleXfs>
-    <cellXfs count="3">
+    <cellXfs count="{{plus (len .Xfs) 6}}">
       <xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
       <xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
       <xf numFmtId="164" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="0"/>
+      <xf numFmtId="0" fontId="2" fillId="0" borderId="1" xfId="0" applyFont="1" applyBorder="1"/>
+      <xf numFmtId="0" fontId="2" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+      <xf numFmtId="49" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/>
+      {{range .Xfs}}
+      {{if .Aligned}}
+      <xf numFmtId="{{.NumFmtID}}" fontId="{{.FontID}}" fillId="{{.FillID}}" borderId="{{.BorderID}}" xfId="0" applyFont="1"{{if .FillID}} applyFill="1"{{end}}{{if .BorderID}} applyBorder="1"{{end}}{{if .NumFmtID}} applyNumberFormat="1"{{end}} applyAlignment="1">
+        <alignment{{with .Alignment.Horizontal}} horizontal="{{.}}"{{end}}{{with .Alignment.Vertical}} vertical="{{.}}"{{end}}{{if .Alignment.WrapText}} wrapText="1"{{end}}/>
+      </xf>
+      {{else}}
+      <xf numFmtId="{{.NumFmtID}}" fontId="{{.FontID}}" fillId="{{.FillID}}" borderId="{{.BorderID}}" xfId="0" applyFont="1"{{if .FillID}} applyFill="1"{{end}}{{if .BorderID}} applyBorder="1"{{end}}{{if .NumFmtID}} applyNumberFormat="1"{{end}}/>
+      {{end}}
+      {{end}}
     </cellXfs>
     <cellStyles count="1">
       <cellStyle name="Normal" xfId="0" builtinId="0"/>
     </cellStyles>
+    {{if .Dxfs}}
+    <dxfs count="{{len .Dxfs}}">
+      {{range .Dxfs}}
+      <dxf>
+        {{if or .Font.Bold .Font.Italic .Font.Color}}
+        <font>{{if .Font.Bold}}<b/>{{end}}{{if .Font.Italic}}<i/>{{end}}{{with .Font.Color}}<color rgb="{{.}}"/>{{end}}</font>
+        {{end}}
+        {{with .Fill}}
+        <fill><patternFill><bgColor rgb="{{.}}"/></patternFill></fill>
+        {{end}}
+      </dxf>
+      {{end}}
+    </dxfs>
+    {{else}}
     <dxfs count="0"/>
+    {{end}}
     <tableStyles count="0" defaultTableStyle="TableStyleMedium2" defaultPivotStyle="PivotStyleLight16"/>
     <extLst>
     </extLst>
   </styleSheet>`
 
 const templateStringLookups = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
-<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="{{len .}}" uniqueCount="{{len .}}">
-{{range .}}<si><t>{{.}}</t></si>{{end}}
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="{{.Count}}" uniqueCount="{{len .Strings}}">
+{{range .Strings}}<si><t>{{.}}</t></si>{{end}}
 </sst>`
 
 const templateSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
-  <worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006" mc:Ignorable="x14ac" xmlns:x14ac="http://schemas.microsoft.com/office/spreadsheetml/2009/9/ac">
-            <sheetViews>
-        <sheetView workbookViewId="0"/>
+  <worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"{{if not .OmitExtensions}} xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006" mc:Ignorable="x14ac" xmlns:x14ac="http://schemas.microsoft.com/office/spreadsheetml/2009/9/ac"{{end}}>
+      {{if or .TabRGB .OutlineSummaryAbove .OutlineSummaryLeft .PageSetup.FitToWidth .PageSetup.FitToHeight}}
+      <sheetPr>
+        {{with .TabRGB}}
+        <tabColor rgb="{{.}}"/>
+        {{end}}
+        {{if or .OutlineSummaryAbove .OutlineSummaryLeft}}
+        <outlinePr{{if .OutlineSummaryAbove}} summaryBelow="0"{{end}}{{if .OutlineSummaryLeft}} summaryRight="0"{{end}}/>
+        {{end}}
+        {{if or .PageSetup.FitToWidth .PageSetup.FitToHeight}}
+        <pageSetUpPr fitToPage="1"/>
+        {{end}}
+      </sheetPr>
+      {{end}}
+      {{if .Dimension}}
+      <dimension ref="{{.Dimension}}"/>
+      {{end}}
+      <sheetViews>
+        <sheetView{{if .Active}} tabSelected="1"{{end}}{{if .HideGridLines}} showGridLines="0"{{end}}{{if .RightToLeft}} rightToLeft="1"{{end}} workbookViewId="0"{{if and .TopLeftCell (not .Pane)}} topLeftCell="{{.TopLeftCell}}"{{end}}>
+          {{with .Pane}}
+          <pane{{if .XSplit}} xSplit="{{.XSplit}}"{{end}}{{if .YSplit}} ySplit="{{.YSplit}}"{{end}} topLeftCell="{{.TopLeftCell}}" activePane="{{.ActivePane}}" state="frozen"/>
+          <selection pane="{{.ActivePane}}" activeCell="{{$.Selection}}" sqref="{{$.Selection}}"/>
+          {{else}}
+          {{if .Selection}}
+          <selection activeCell="{{.Selection}}" sqref="{{.Selection}}"/>
+          {{end}}
+          {{end}}
+        </sheetView>
       </sheetViews>
-      <sheetFormatPr defaultRowHeight="15" x14ac:dyDescent="0.25"/>
+      <sheetFormatPr{{with .DefaultColWidth}} defaultColWidth="{{.}}"{{end}} defaultRowHeight="{{or .DefaultRowHeight 15}}"{{if .DefaultRowHeight}} customHeight="1"{{end}}{{with .OutlineLevelRow}} outlineLevelRow="{{.}}"{{end}}{{with .OutlineLevelCol}} outlineLevelCol="{{.}}"{{end}}{{if not .OmitExtensions}} x14ac:dyDescent="0.25"{{end}}/>
+      {{if .Cols}}
         <cols>
           {{range $i, $e := .Cols}}
-          <col min="{{plus $i 1}}" max="{{plus $i 1}}" width="{{$e.Width}}" customWidth="1" style="1"/>
+          <col min="{{plus $i 1}}" max="{{plus $i 1}}"{{with $e.Width}} width="{{.}}" customWidth="1"{{end}}{{if $e.Hidden}} hidden="1"{{end}}{{if not $.OmitStyles}} style="{{$e.Style}}"{{end}}{{with $e.OutlineLevel}} outlineLevel="{{.}}"{{end}}/>
           {{end}}
         </cols>
+      {{end}}
       <sheetData>`
 
+const templateSheetEnd = `</sheetData>
+      {{with .FilterRange}}
+      <autoFilter ref="{{.}}"/>
+      {{end}}
+      {{if .MergeCells}}
+      <mergeCells count="{{len .MergeCells}}">
+        {{range .MergeCells}}
+        <mergeCell ref="{{.}}"/>
+        {{end}}
+      </mergeCells>
+      {{end}}
+      {{range .ConditionalFormats}}
+      <conditionalFormatting sqref="{{.Range}}">
+        <cfRule type="{{.Type}}"{{if .Operator}} dxfId="{{.DxfID}}"{{end}} priority="{{.Priority}}"{{with .Operator}} operator="{{.}}"{{end}}>
+          {{if .Operator}}
+          <formula>{{html .Formula1}}</formula>
+          {{with .Formula2}}<formula>{{html .}}</formula>{{end}}
+          {{else if eq .Type "dataBar"}}
+          <dataBar><cfvo type="min"/><cfvo type="max"/>{{range .Colors}}<color rgb="{{.}}"/>{{end}}</dataBar>
+          {{else}}
+          <colorScale><cfvo type="min"/>{{if eq (len .Colors) 3}}<cfvo type="percentile" val="50"/>{{end}}<cfvo type="max"/>{{range .Colors}}<color rgb="{{.}}"/>{{end}}</colorScale>
+          {{end}}
+        </cfRule>
+      </conditionalFormatting>
+      {{end}}
+      {{if .DataValidations}}
+      <dataValidations count="{{len .DataValidations}}">
+        {{range .DataValidations}}
+        <dataValidation type="{{.Type}}"{{if .AllowBlank}} allowBlank="1"{{end}} showErrorMessage="1" sqref="{{.Range}}">
+          <formula1>{{html .Formula1}}</formula1>
+          {{with .Formula2}}<formula2>{{.}}</formula2>{{end}}
+        </dataValidation>
+        {{end}}
+      </dataValidations>
+      {{end}}
+      {{if or .PrintGridLines .PrintHeadings}}
+      <printOptions{{if .PrintHeadings}} headings="1"{{end}}{{if .PrintGridLines}} gridLines="1"{{end}}/>
+      {{end}}
+      {{with .PageSetup.Margins}}
+      <pageMargins left="{{.Left}}" right="{{.Right}}" top="{{.Top}}" bottom="{{.Bottom}}" header="{{.Header}}" footer="{{.Footer}}"/>
+      {{end}}
+      {{with .PageSetup}}
+      {{if or .Landscape .PaperSize .FitToWidth .FitToHeight}}
+      <pageSetup{{if .PaperSize}} paperSize="{{.PaperSize}}"{{end}}{{if or .FitToWidth .FitToHeight}} fitToWidth="{{.FitToWidth}}" fitToHeight="{{.FitToHeight}}"{{end}}{{if .Landscape}} orientation="landscape"{{end}}/>
+      {{end}}
+      {{end}}
+      {{if or .Header.String .Footer.String}}
+      <headerFooter>
+        {{with .Header.String}}<oddHeader>{{html .}}</oddHeader>{{end}}
+        {{with .Footer.String}}<oddFooter>{{html .}}</oddFooter>{{end}}
+      </headerFooter>
+      {{end}}
+      {{if .Drawing}}
+      <drawing r:id="rId1"/>
+      {{end}}
+  </worksheet>`
+
+const templateSheetRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+  <Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+      <Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/drawing" Target="{{.}}"/>
+  </Relationships>`
+
+const templateDrawing = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+  <xdr:wsDr xmlns:xdr="http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+      {{range $i, $e := .}}
+      {{if $e.Absolute}}
+      <xdr:absoluteAnchor>
+        <xdr:pos x="{{$e.X}}" y="{{$e.Y}}"/>
+      {{else}}
+      <xdr:oneCellAnchor>
+        <xdr:from><xdr:col>{{$e.Col}}</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>{{$e.Row}}</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from>
+      {{end}}
+        <xdr:ext cx="{{$e.Width}}" cy="{{$e.Height}}"/>
+        <xdr:pic>
+          <xdr:nvPicPr>
+            <xdr:cNvPr id="{{plus $i 2}}" name="Picture {{plus $i 1}}"/>
+            <xdr:cNvPicPr><a:picLocks noChangeAspect="1"/></xdr:cNvPicPr>
+          </xdr:nvPicPr>
+          <xdr:blipFill>
+            <a:blip r:embed="rId{{plus $i 1}}"/>
+            <a:stretch><a:fillRect/></a:stretch>
+          </xdr:blipFill>
+          <xdr:spPr>
+            <a:xfrm><a:off x="{{$e.X}}" y="{{$e.Y}}"/><a:ext cx="{{$e.Width}}" cy="{{$e.Height}}"/></a:xfrm>
+            <a:prstGeom prst="rect"><a:avLst/></a:prstGeom>
+          </xdr:spPr>
+        </xdr:pic>
+        <xdr:clientData/>
+      {{if $e.Absolute}}
+      </xdr:absoluteAnchor>
+      {{else}}
+      </xdr:oneCellAnchor>
+      {{end}}
+      {{end}}
+  </xdr:wsDr>`
+
+const templateDrawingRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+  <Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+      {{range $i, $e := .}}
+      <Relationship Id="rId{{plus $i 1}}" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="../media/{{$e.Name}}"/>
+      {{end}}
+  </Relationships>`
+
 const templateApp = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
   <Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">
-  <Application>None</Application>
+  <Application>{{html .Application}}</Application>
   <DocSecurity>0</DocSecurity>
   <ScaleCrop>false</ScaleCrop>
   <HeadingPairs>
@@ -159,15 +366,19 @@ const templateApp = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
         <vt:lpstr>Worksheets</vt:lpstr>
       </vt:variant>
       <vt:variant>
-        <vt:i4>1</vt:i4>
+        <vt:i4>{{len .Sheets}}</vt:i4>
       </vt:variant>
     </vt:vector>
   </HeadingPairs>
   <TitlesOfParts>
-    <vt:vector size="1" baseType="lpstr">
-      <vt:lpstr>{{.Title}}</vt:lpstr>
+    <vt:vector size="{{len .Sheets}}" baseType="lpstr">
+      {{range .Sheets}}
+      <vt:lpstr>{{html .Title}}</vt:lpstr>
+      {{end}}
     </vt:vector>
   </TitlesOfParts>
+  {{with .DocumentInfo.Manager}}<Manager>{{html .}}</Manager>{{end}}
+  {{with .DocumentInfo.Company}}<Company>{{html .}}</Company>{{end}}
   <LinksUpToDate>false</LinksUpToDate>
   <SharedDoc>false</SharedDoc>
   <HyperlinksChanged>false</HyperlinksChanged>
@@ -175,8 +386,13 @@ const templateApp = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
 
 const templateCore = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
   <cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:dcmitype="http://purl.org/dc/dcmitype/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
-    <dc:creator>{{.CreatedBy}}</dc:creator>
-    <cp:lastModifiedBy>{{.ModifiedBy}}</cp:lastModifiedBy>
+    {{with .Title}}<dc:title>{{html .}}</dc:title>{{end}}
+    {{with .Subject}}<dc:subject>{{html .}}</dc:subject>{{end}}
+    <dc:creator>{{html .CreatedBy}}</dc:creator>
+    {{with .Keywords}}<cp:keywords>{{html .}}</cp:keywords>{{end}}
+    {{with .Description}}<dc:description>{{html .}}</dc:description>{{end}}
+    <cp:lastModifiedBy>{{html .ModifiedBy}}</cp:lastModifiedBy>
     <dcterms:created xsi:type="dcterms:W3CDTF">{{timeFormat .CreatedAt}}</dcterms:created>
     <dcterms:modified xsi:type="dcterms:W3CDTF">{{timeFormat .ModifiedAt}}</dcterms:modified>
+    {{with .Category}}<cp:category>{{html .}}</cp:category>{{end}}
   </cp:coreProperties>`
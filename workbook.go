@@ -0,0 +1,111 @@
+package xlsx
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// A workbook of sheets held in memory, which are saved together. The shared
+// strings and styles of the sheets are combined in the saved workbook.
+// Workbook options, such as the DocumentInfo and Date1904, are taken from
+// the first sheet.
+type Workbook struct {
+	sheets []*Sheet
+}
+
+// Create a workbook with no sheets
+func NewWorkbook() *Workbook {
+	return &Workbook{}
+}
+
+// Add a sheet to the end of the workbook. Rows may still be appended to the
+// sheet until the workbook is saved. A sheet whose title is already used in
+// the workbook is renamed when it is saved, as by WorkbookWriter.
+func (wb *Workbook) AddSheet(s *Sheet) error {
+	for _, e := range wb.sheets {
+		if e == s {
+			return errors.New("the sheet is already in the workbook")
+		}
+	}
+
+	wb.sheets = append(wb.sheets, s)
+
+	return nil
+}
+
+// The sheets of the workbook in order
+func (wb *Workbook) Sheets() []*Sheet {
+	return wb.sheets
+}
+
+// Save the workbook in XLSX format to the writer. A workbook without sheets
+// is saved with a single empty sheet.
+func (wb *Workbook) Save(w io.Writer) error {
+	ww := NewWorkbookWriter(w)
+
+	for _, s := range wb.sheets {
+		err := ww.writeSheet(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ww.Close()
+}
+
+// Save the workbook in XLSX format to the named file
+func (wb *Workbook) SaveToFile(filename string) error {
+	outputfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outputfile.Close()
+	w := bufio.NewWriter(outputfile)
+	err = wb.Save(w)
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Write a first sheet titled "About" listing the keys of info, in bold and in
+// sorted order, beside their values, for example the time the workbook was
+// generated, its source system and the number of rows of each data sheet.
+// It must be called before any other sheet is written. The workbook options
+// and document properties are taken from the first sheet, so call
+// WriteHeader with the data sheet beforehand to take them from that instead.
+func (ww *WorkbookWriter) AddMetadataSheet(info map[string]string) error {
+	if len(ww.sheets) > 0 {
+		return errors.New("the metadata sheet must be the first sheet of the workbook")
+	}
+
+	s := NewSheetWithColumns([]Column{Column{Name: "Key"}, Column{Name: "Value"}})
+	s.Title = "About"
+	s.AutoWidth = true
+	bold := s.AddStyle(Style{Font: Font{Bold: true}})
+
+	keys := make([]string, 0, len(info))
+	for k := range info {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		key := NewStringCell(k)
+		key.Style = bold
+		err := s.AppendRow(Row{Cells: []Cell{key, NewStringCell(info[k])}})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := ww.writeSheet(&s)
+	if err != nil {
+		return err
+	}
+
+	return ww.sheetWriter.Close()
+}
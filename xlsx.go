@@ -1,17 +1,31 @@
 // Package implements creation of XLSX simple spreadsheet files
-
+//
+// Cell values are stored in the locale-independent form required by the file
+// format: numbers and dates use "." as the decimal separator and have no
+// digit grouping. The values produced by TypedCell and OADate never depend on
+// the locale of the machine writing the file; how they are displayed is left
+// to the number formats and the locale of the application opening it.
 package xlsx
 
 import (
 	"archive/zip"
 	"bufio"
-	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
 	"fmt"
 	"html"
 	"io"
+	"io/ioutil"
+	"math"
 	"os"
+	"reflect"
+	"regexp"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
+	"unicode/utf8"
 )
 
 type CellType uint
@@ -22,23 +36,459 @@ const (
 	CellTypeString
 	CellTypeDatetime
 	CellTypeInlineString
+	CellTypeBool
+	CellTypeFormula
+
+	// A number shown as a percentage: 0.25 is shown as 25%
+	CellTypePercent
+
+	// A datetime shown as a date without the time of day
+	CellTypeDate
+)
+
+// Visibility of a sheet in the workbook's tab bar
+type SheetState uint
+
+const (
+	SheetVisible SheetState = iota
+	// Hidden, but can be unhidden from Excel
+	SheetHidden
+	// Hidden, and can only be unhidden programmatically
+	SheetVeryHidden
+)
+
+func (s SheetState) String() string {
+	switch s {
+	case SheetHidden:
+		return "hidden"
+	case SheetVeryHidden:
+		return "veryHidden"
+	}
+	return "visible"
+}
+
+// Reference to the style of a cell
+type StyleID uint
+
+// Built-in cell styles
+const (
+	// Style chosen from the type of the cell and its column
+	StyleDefault StyleID = iota
+	// General number format in the workbook's default font
+	StyleGeneral
+)
+
+// StyleID of the first style registered with Sheet.AddStyle
+const firstCustomStyle = StyleGeneral + 1
+
+// Number of cellXfs entries in the styles template, which precede the
+// registered styles
+const builtinXfs = 6
+
+// First numFmtId available to the number formats of registered styles. Lower
+// IDs are built into Excel or used by the styles template.
+const firstCustomNumFmt = 166
+
+// Number format codes for Style.NumberFormat and Column.NumberFormat
+const (
+	FormatInteger        = "0"
+	FormatFixed          = "0.00"
+	FormatThousands      = "#,##0"
+	FormatThousandsFixed = "#,##0.00"
+	FormatPercent        = "0.00%"
+	FormatScientific     = "0.00E+00"
+	FormatText           = "@"
+
+	// Formats of CellTypeDatetime and CellTypeDate cells
+	FormatDateTime = `yyyy\-mm\-dd\ hh:mm`
+	FormatDate     = `yyyy\-mm\-dd;@`
+)
+
+// Number formats built into Excel, which are referenced by their IDs rather
+// than declared in the styles
+var builtinNumFmts = map[string]int{
+	"0":        1,
+	"0.00":     2,
+	"#,##0":    3,
+	"#,##0.00": 4,
+	"0%":       9,
+	"0.00%":    10,
+	"0.00E+00": 11,
+	"@":        49,
+
+	// declared by the styles template
+	FormatDateTime: 164,
+	FormatDate:     165,
+}
+
+// Formatting of a cell, which is registered with Sheet.AddStyle
+type Style struct {
+	// Number format code, for example "0.00%" or "#,##0". The General
+	// format is used when this is empty.
+	NumberFormat string
+
+	// Font of the cell. The zero Font is the font of unstyled cells.
+	Font Font
+
+	// Alignment of the content of the cell
+	Alignment Alignment
+
+	// Background colour of the cell as hexadecimal RGB, for example
+	// "FF0000" for red, or ARGB. The cell has no fill when this is empty.
+	Fill string
+
+	// thin border above the cell, as of the cells of a total row
+	border bool
+}
+
+// Alignment of a Style. Horizontal is one of "general", "left", "center",
+// "right", "fill", "justify", "centerContinuous" or "distributed", and
+// Vertical one of "top", "center", "bottom", "justify" or "distributed". Empty
+// values leave the alignment to Excel, which aligns text left, numbers right
+// and both at the bottom of the cell. WrapText wraps text onto several lines
+// within the width of the column; the row must be tall enough to show them,
+// for example by setting Row.Height.
+type Alignment struct {
+	Horizontal string
+	Vertical   string
+	WrapText   bool
+}
+
+var (
+	horizontalAlignments = map[string]bool{"": true, "general": true, "left": true, "center": true, "right": true, "fill": true, "justify": true, "centerContinuous": true, "distributed": true}
+	verticalAlignments   = map[string]bool{"": true, "top": true, "center": true, "bottom": true, "justify": true, "distributed": true}
 )
 
+var colorPattern = regexp.MustCompile(`^([0-9A-Fa-f]{2})?[0-9A-Fa-f]{6}$`)
+
+// The hexadecimal RGB or ARGB colour as opaque ARGB, for example "ff0000" =>
+// "FFFF0000"
+func argb(color string) string {
+	if len(color) == 6 {
+		color = "FF" + color
+	}
+	return strings.ToUpper(color)
+}
+
+// Check that the style can be written to the styles of a workbook
+func (st Style) validate() error {
+	if st.Font.Color != "" && !colorPattern.MatchString(st.Font.Color) {
+		return fmt.Errorf("invalid font colour %q", st.Font.Color)
+	}
+	if st.Fill != "" && !colorPattern.MatchString(st.Fill) {
+		return fmt.Errorf("invalid fill colour %q", st.Fill)
+	}
+	if !horizontalAlignments[st.Alignment.Horizontal] {
+		return fmt.Errorf("invalid horizontal alignment %q", st.Alignment.Horizontal)
+	}
+	if !verticalAlignments[st.Alignment.Vertical] {
+		return fmt.Errorf("invalid vertical alignment %q", st.Alignment.Vertical)
+	}
+	return nil
+}
+
+// Font of a Style. Fields left empty take the values of the font of unstyled
+// cells: 11 point black Arial Unicode MS.
+type Font struct {
+	Bold   bool
+	Italic bool
+
+	// Size in points
+	Size float64
+
+	// Colour as hexadecimal RGB, for example "FF0000", or ARGB
+	Color string
+	Name  string
+}
+
+// The font with its empty fields set to those of the font of unstyled cells
+func (f Font) resolved() Font {
+	if f.Size == 0 {
+		f.Size = 11
+	}
+	if f.Color == "" {
+		f.Color = "FF000000"
+	}
+	f.Color = argb(f.Color)
+	if f.Name == "" {
+		f.Name = "Arial Unicode MS"
+	}
+	return f
+}
+
 // XLSX Spreadsheet Cell
 type Cell struct {
 	Type  CellType
 	Value string
+	Style StyleID
+
+	// Number of columns the cell spans, merging it with the cells to its
+	// right. Zero and one leave the cell unmerged.
+	Colspan uint64
+
+	// Number of rows the cell spans, merging it with the cells below it,
+	// which may be written by later calls to WriteRows. With Colspan this
+	// merges a rectangle of cells. Zero and one leave the cell unmerged.
+	Rowspan uint64
+
+	// Cached result of a CellTypeFormula cell, shown by applications which
+	// do not recalculate the formula. A formula without a result is
+	// calculated when the workbook is opened.
+	Result string
+
+	// Time of a CellTypeDatetime or CellTypeDate cell, which is used instead
+	// of Value when it is not the zero time, so that the time need not be
+	// formatted and parsed again
+	Time time.Time
+
+	// Runs of differently formatted text making up a CellTypeInlineString
+	// cell, which are written in place of its Value. They are held by
+	// pointer so that cells can still be compared.
+	Rich *RichText
+
+	// the Value of a CellTypeString cell is a reference to the shared
+	// string table of its sheet rather than the text itself
+	shared bool
+}
+
+// Formatted text of a rich text cell
+type RichText []TextRun
+
+// A run of text within a rich text cell
+type TextRun struct {
+	Text string
+
+	// Font of the run. Fields left empty take the values of the font of
+	// the cell.
+	Font Font
+}
+
+// Error returned by TypedCellStrict when a value has no corresponding cell
+// type
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	if e.Type == nil {
+		return "xlsx: unsupported cell value type <nil>"
+	}
+	return "xlsx: unsupported cell value type " + e.Type.String()
+}
+
+// Create a cell from a Go value, choosing the cell type from the type of the
+// value. Integers and floats become numbers, bools become booleans, time.Time
+// becomes a datetime and strings become shared strings. Values of any other
+// type are stringified with fmt.Sprint into a string cell.
+func TypedCell(v interface{}) Cell {
+	c, err := TypedCellStrict(v)
+	if err != nil {
+		if v == nil {
+			return Cell{Type: CellTypeString}
+		}
+		return Cell{Type: CellTypeString, Value: fmt.Sprint(v)}
+	}
+	return c
+}
+
+// Create a cell from a Go value as TypedCell does, but return an
+// *UnsupportedTypeError rather than stringifying values of other types
+func TypedCellStrict(v interface{}) (Cell, error) {
+	switch x := v.(type) {
+	case int:
+		return NewIntCell(x), nil
+	case int8:
+		return Cell{Type: CellTypeNumber, Value: strconv.FormatInt(int64(x), 10)}, nil
+	case int16:
+		return Cell{Type: CellTypeNumber, Value: strconv.FormatInt(int64(x), 10)}, nil
+	case int32:
+		return Cell{Type: CellTypeNumber, Value: strconv.FormatInt(int64(x), 10)}, nil
+	case int64:
+		return Cell{Type: CellTypeNumber, Value: strconv.FormatInt(x, 10)}, nil
+	case uint:
+		return Cell{Type: CellTypeNumber, Value: strconv.FormatUint(uint64(x), 10)}, nil
+	case uint8:
+		return Cell{Type: CellTypeNumber, Value: strconv.FormatUint(uint64(x), 10)}, nil
+	case uint16:
+		return Cell{Type: CellTypeNumber, Value: strconv.FormatUint(uint64(x), 10)}, nil
+	case uint32:
+		return Cell{Type: CellTypeNumber, Value: strconv.FormatUint(uint64(x), 10)}, nil
+	case uint64:
+		return Cell{Type: CellTypeNumber, Value: strconv.FormatUint(x, 10)}, nil
+	case float32:
+		return Cell{Type: CellTypeNumber, Value: formatFloat(float64(x), 32)}, nil
+	case float64:
+		return NewNumberCell(x), nil
+	case bool:
+		return NewBoolCell(x), nil
+	case time.Time:
+		return NewDateCell(x), nil
+	case string:
+		return NewStringCell(x), nil
+	}
+
+	return Cell{}, &UnsupportedTypeError{reflect.TypeOf(v)}
+}
+
+// Create a number cell holding the shortest decimal representation which
+// reads back as exactly v, for example 0.1 rather than 0.10000000000000001.
+// Very large and very small values are held in exponent form, for example
+// 1.6e-19.
+func NewNumberCell(v float64) Cell {
+	return Cell{Type: CellTypeNumber, Value: formatFloat(v, 64)}
+}
+
+// The shortest representation of v which reads back exactly as a float of
+// the given bit size, in exponent form outside the range 1e-6 to 1e21 as in
+// JavaScript
+func formatFloat(v float64, bitSize int) string {
+	if a := math.Abs(v); a != 0 && (a < 1e-6 || a >= 1e21) {
+		return strconv.FormatFloat(v, 'e', -1, bitSize)
+	}
+	return strconv.FormatFloat(v, 'f', -1, bitSize)
+}
+
+// Create a number cell holding v rounded to prec decimal places
+func NewNumberCellWithPrecision(v float64, prec int) Cell {
+	return Cell{Type: CellTypeNumber, Value: strconv.FormatFloat(v, 'f', prec, 64)}
+}
+
+// Make the cell a number cell holding v rounded to prec decimal places, or
+// the shortest representation of v which reads back exactly when prec is
+// negative. The style of the cell is kept.
+func (c *Cell) SetFloat(v float64, prec int) {
+	n := NewNumberCell(v)
+	if prec >= 0 {
+		n = NewNumberCellWithPrecision(v, prec)
+	}
+	c.Type = n.Type
+	c.Value = n.Value
+}
+
+// Create a number cell holding the integer v
+func NewIntCell(v int) Cell {
+	return Cell{Type: CellTypeNumber, Value: strconv.Itoa(v)}
+}
+
+// Create a shared string cell. The string is added to the shared string table
+// when the cell is appended to a sheet, or written with a SheetWriter.
+func NewStringCell(v string) Cell {
+	return Cell{Type: CellTypeString, Value: v}
+}
+
+// Create an inline string cell made up of runs of text with their own fonts,
+// for example
+//
+//	NewRichTextCell(TextRun{Text: "Status: "}, TextRun{Text: "FAILED", Font: Font{Bold: true, Color: "FF0000"}})
+//
+// The Value of the cell is the text of the runs joined together.
+func NewRichTextCell(runs ...TextRun) Cell {
+	var v strings.Builder
+	for _, r := range runs {
+		v.WriteString(r.Text)
+	}
+	rich := RichText(runs)
+	return Cell{Type: CellTypeInlineString, Value: v.String(), Rich: &rich}
+}
+
+// The runs of the rich text as the XML of an inline string
+func (rt RichText) xml() (string, error) {
+	var b strings.Builder
+	for _, r := range rt {
+		f := r.Font
+		if f.Color != "" && !colorPattern.MatchString(f.Color) {
+			return "", fmt.Errorf("invalid font colour %q", f.Color)
+		}
+
+		b.WriteString("<r>")
+		if f != (Font{}) {
+			// the elements of the run properties are in the schema's order
+			b.WriteString("<rPr>")
+			if f.Name != "" {
+				b.WriteString(`<rFont val="` + html.EscapeString(f.Name) + `"/>`)
+			}
+			if f.Bold {
+				b.WriteString("<b/>")
+			}
+			if f.Italic {
+				b.WriteString("<i/>")
+			}
+			if f.Color != "" {
+				b.WriteString(`<color rgb="` + argb(f.Color) + `"/>`)
+			}
+			if f.Size != 0 {
+				b.WriteString(`<sz val="` + strconv.FormatFloat(f.Size, 'f', -1, 64) + `"/>`)
+			}
+			b.WriteString("</rPr>")
+		}
+		b.WriteString(`<t xml:space="preserve">` + html.EscapeString(r.Text) + "</t></r>")
+	}
+	return b.String(), nil
+}
+
+// Create a boolean cell
+func NewBoolCell(v bool) Cell {
+	if v {
+		return Cell{Type: CellTypeBool, Value: "1"}
+	}
+	return Cell{Type: CellTypeBool, Value: "0"}
+}
+
+// Create a datetime cell holding v as its Time, and as an RFC3339 Value
+func NewDateCell(v time.Time) Cell {
+	return Cell{Type: CellTypeDatetime, Value: v.Format(time.RFC3339), Time: v}
 }
 
 // XLSX Spreadsheet Row
 type Row struct {
 	Cells []Cell
+
+	// Height of the row in points. Zero leaves the row at the default
+	// height.
+	Height float64
+
+	// Level of the row in the sheet's outline, from 0 for ungrouped rows to
+	// 7. Consecutive rows of a higher level are grouped under the following
+	// row, or the preceding one when the sheet's OutlineSummaryAbove is set.
+	OutlineLevel uint
 }
 
 // XLSX Spreadsheet Column
 type Column struct {
-	Name  string
+	Name string
+
+	// Width in characters. Zero leaves the column at the sheet's default
+	// width.
 	Width uint64
+
+	// Hide the column. Its cells are still written and can be referred to
+	// by formulas.
+	Hidden bool
+
+	// Type of the data in the column. A CellTypeDatetime column is
+	// given the datetime format, so number cells in it can hold bare OLE
+	// Automation date values and still display as dates.
+	Type CellType
+
+	// Hold every cell of the column as text in the text ("@") format,
+	// whatever the type of the cell. This keeps identifiers such as phone
+	// numbers from being converted to numbers by Excel.
+	Text bool
+
+	// Number format code applied to the number and datetime cells of the
+	// column, for example "#,##0.00" or "0.00%"
+	NumberFormat string
+
+	// Type given to the cells of the column by NewRow, and by AppendRow to
+	// unset cells, which have the zero type CellTypeNumber and no Value.
+	// Number cells with a value keep their type.
+	DefaultType CellType
+
+	// Level of the column in the sheet's outline, from 0 for ungrouped
+	// columns to 7. Consecutive columns of a higher level are grouped
+	// before the following column, or after the preceding one when the
+	// sheet's OutlineSummaryLeft is set.
+	OutlineLevel uint
 }
 
 // XLSX Spreadsheet Document Properties
@@ -47,9 +497,30 @@ type DocumentInfo struct {
 	ModifiedBy string
 	CreatedAt  time.Time
 	ModifiedAt time.Time
+
+	// Descriptive properties, which are omitted when empty
+	Title       string
+	Subject     string
+	Keywords    string
+	Description string
+	Category    string
+
+	// Extended properties. Application names the program which created the
+	// workbook, and is "github.com/psmithuk/xlsx" when empty.
+	Company     string
+	Manager     string
+	Application string
 }
 
+// Application written to the extended properties when DocumentInfo has none
+const defaultApplication = "github.com/psmithuk/xlsx"
+
 // XLSX Spreadsheet
+//
+// A Sheet is not safe for concurrent use: appending rows and registering
+// styles update its shared string table and styles. Rows can instead be
+// built concurrently, as creating cells does not involve the sheet, and
+// appended from a single goroutine with AppendRows.
 type Sheet struct {
 	Title           string
 	columns         []Column
@@ -57,8 +528,428 @@ type Sheet struct {
 	sharedStringMap map[string]int
 	sharedStrings   []string
 	DocumentInfo    DocumentInfo
+
+	// Outline summary position. By default Excel places the summary row of
+	// a group below its detail rows and the summary column to the right of
+	// its detail columns.
+	OutlineSummaryAbove bool
+	OutlineSummaryLeft  bool
+
+	// Cell selected when the sheet is opened, for example "A2". Excel
+	// selects A1 when this is empty.
+	ActiveCell string
+
+	// Cell shown in the top left of the window when the sheet is opened,
+	// for example "A100" to open the sheet scrolled down to row 100. When
+	// rows or columns are frozen this is the top left cell of the
+	// scrolling pane.
+	TopLeftCell string
+
+	// Number of rows at the top and columns at the left of the sheet which
+	// are frozen, staying visible while the rest of the sheet scrolls.
+	// FreezeRows of 1 keeps a header row in view. Unless ActiveCell is set,
+	// the first cell below and right of the frozen area is selected.
+	FreezeRows uint64
+	FreezeCols uint64
+
+	// Hide the cell gridlines when the sheet is shown on screen
+	HideGridLines bool
+
+	// Width in characters of the columns without a Width, and height in
+	// points of the rows without a Height. Zero leaves Excel's defaults.
+	DefaultColWidth  float64
+	DefaultRowHeight float64
+
+	// Show the sheet right to left, with column A on the right, for
+	// languages such as Arabic and Hebrew
+	RightToLeft bool
+
+	// Visibility of the sheet. At least one sheet in a workbook must be
+	// visible.
+	State SheetState
+
+	// Open the workbook on this sheet, with its tab selected, rather than
+	// on the first visible sheet. At most one sheet of a workbook may be
+	// active, and it must be visible.
+	Active bool
+
+	// Colour of the sheet's tab as hexadecimal RGB, for example "00B050",
+	// or ARGB
+	TabColor string
+
+	// Print the cell gridlines and the row and column headings. These are
+	// independent of whether gridlines are shown on screen.
+	PrintGridLines bool
+	PrintHeadings  bool
+
+	// Range of cells to print, for example "A1:F40". The print area is
+	// scoped to this sheet.
+	PrintArea string
+
+	// Range of cells with filter dropdowns in its first row, for example
+	// "A1:D100"
+	AutoFilter string
+
+	// Orientation, paper size, scaling and margins of the printed sheet
+	PageSetup PageSetup
+
+	// Text printed at the top and bottom of every page
+	Header HeaderFooter
+	Footer HeaderFooter
+
+	// Leave the styles part out of the workbook. Cells are then written
+	// with the default style, so this is only suitable for sheets of
+	// numbers, strings and booleans; writing a datetime cell fails. This is
+	// a workbook option, taken from the header sheet, and applies to the
+	// cells of every sheet.
+	OmitStyles bool
+
+	// Style the last row and the last column of the sheet as totals, in
+	// bold with a border above the total row. TotalRow is only supported by
+	// SaveToWriter, SaveToFile and Workbook, which know the extent of the
+	// sheet before it is written; NewSheetWriter returns an error for it,
+	// and a streamed sheet's total row is instead written with
+	// SheetWriter.WriteTotalRow.
+	TotalRow    bool
+	TotalColumn bool
+
+	// Leave out the optional markup compatibility (mc) and Excel 2010
+	// (x14ac) extensions, for parsers which only accept the core schema
+	OmitExtensions bool
+
+	// Write the text of inline string cells to the shared string table of
+	// the workbook, so that repeated text is stored once. Unlike
+	// CellTypeString cells, these need not be added to the sheet first,
+	// so this suits text streamed with a SheetWriter. Rich text cells are
+	// always written inline.
+	ShareInlineStrings bool
+
+	// Size the columns to fit their content when the sheet is written.
+	// The rows of the sheet are held in a temporary file until it is
+	// closed, as the columns precede the rows in the file.
+	AutoWidth bool
+
+	// Use the 1904 date system of older Mac workbooks, in which datetime
+	// cells count days from 1904-01-01 rather than 1899-12-30. This is a
+	// workbook option, taken from the header sheet.
+	Date1904 bool
+
+	styles []Style
+
+	// rows repeated at the top of each printed page, for example "$1:$2"
+	printTitleRows string
+
+	// filter every row written when AutoFilter is empty
+	filterRows bool
+
+	dataValidations []DataValidation
+
+	conditionalFormats []ConditionalFormat
+
+	images []sheetImage
+}
+
+// Kind of value allowed by a DataValidation
+type ValidationType uint
+
+const (
+	// One of a list of values, chosen from a dropdown
+	ValidationList ValidationType = iota
+	// A whole number between Min and Max
+	ValidationWhole
+	// A decimal number between Min and Max
+	ValidationDecimal
+)
+
+func (t ValidationType) String() string {
+	switch t {
+	case ValidationWhole:
+		return "whole"
+	case ValidationDecimal:
+		return "decimal"
+	}
+	return "list"
+}
+
+// Constraint on the values entered in a range of cells
+type DataValidation struct {
+	// Cells validated, for example "B2:B100"
+	Range string
+	Type  ValidationType
+
+	// Allowed values of a list validation
+	Values []string
+	// Reference to the allowed values of a list validation, for example
+	// "$D$1:$D$3", which is used instead of Values
+	Source string
+
+	// Inclusive bounds of a whole number or decimal validation
+	Min, Max float64
+
+	// Allow the cells to be left empty
+	AllowBlank bool
+}
+
+// Data validation as written to the sheet XML
+type validationData struct {
+	Type       string
+	Range      string
+	Formula1   string
+	Formula2   string
+	AllowBlank bool
+}
+
+var rangePattern = regexp.MustCompile(`^[A-Za-z]{1,3}[0-9]+(:[A-Za-z]{1,3}[0-9]+)?$`)
+
+// Maximum length of the comma separated values of a list validation
+const maxValidationList = 255
+
+// Constrain the values entered in a range of cells
+func (s *Sheet) AddDataValidation(v DataValidation) error {
+	_, err := v.data()
+	if err != nil {
+		return err
+	}
+
+	s.dataValidations = append(s.dataValidations, v)
+
+	return nil
+}
+
+func (v DataValidation) data() (validationData, error) {
+	d := validationData{
+		Type:       v.Type.String(),
+		Range:      strings.ToUpper(v.Range),
+		AllowBlank: v.AllowBlank,
+	}
+
+	if !rangePattern.MatchString(v.Range) {
+		return d, fmt.Errorf("invalid data validation range %q", v.Range)
+	}
+
+	switch v.Type {
+	case ValidationList:
+		if v.Source != "" {
+			d.Formula1 = strings.TrimPrefix(v.Source, "=")
+			break
+		}
+		if len(v.Values) == 0 {
+			return d, errors.New("list validation needs Values or a Source")
+		}
+		for _, value := range v.Values {
+			if strings.Contains(value, ",") {
+				return d, fmt.Errorf("list validation value %q contains a comma", value)
+			}
+		}
+		list := strings.Join(v.Values, ",")
+		if len(list) > maxValidationList {
+			return d, fmt.Errorf("list validation values exceed %d characters", maxValidationList)
+		}
+		d.Formula1 = `"` + strings.Replace(list, `"`, `""`, -1) + `"`
+	case ValidationWhole, ValidationDecimal:
+		if v.Max < v.Min {
+			return d, fmt.Errorf("invalid validation bounds %v to %v", v.Min, v.Max)
+		}
+		if v.Type == ValidationWhole && (v.Min != math.Trunc(v.Min) || v.Max != math.Trunc(v.Max)) {
+			return d, fmt.Errorf("whole number validation bounds %v to %v are not whole", v.Min, v.Max)
+		}
+		d.Formula1 = strconv.FormatFloat(v.Min, 'f', -1, 64)
+		d.Formula2 = strconv.FormatFloat(v.Max, 'f', -1, 64)
+	default:
+		return d, fmt.Errorf("invalid validation type %d", v.Type)
+	}
+
+	return d, nil
+}
+
+// Kind of rule of a ConditionalFormat
+type ConditionType uint
+
+const (
+	// Fill colours graded by value from MinColor at the lowest value to
+	// MaxColor at the highest, through MidColor at the median when it is set
+	ConditionColorScale ConditionType = iota
+	// A bar of Color with a length proportional to the value
+	ConditionDataBar
+	// Style applied to the cells whose value compares to Formula1, and
+	// Formula2 for between and notBetween, by Operator
+	ConditionCellIs
+)
+
+func (t ConditionType) String() string {
+	switch t {
+	case ConditionDataBar:
+		return "dataBar"
+	case ConditionCellIs:
+		return "cellIs"
+	}
+	return "colorScale"
+}
+
+// Formatting of a range of cells which depends on their values, for example
+// a red, yellow and green colour scale
+//
+//	ConditionalFormat{Range: "B2:B100", MinColor: "F8696B", MidColor: "FFEB84", MaxColor: "63BE7B"}
+type ConditionalFormat struct {
+	// Cells formatted, for example "B2:B100"
+	Range string
+	Type  ConditionType
+
+	// Colours of a colour scale or data bar as hexadecimal RGB, for example
+	// "FF0000", or ARGB
+	MinColor, MidColor, MaxColor string
+	Color                        string
+
+	// Comparison of a cellIs rule: one of "equal", "notEqual",
+	// "greaterThan", "greaterThanOrEqual", "lessThan", "lessThanOrEqual",
+	// "between" or "notBetween"
+	Operator string
+
+	// Values or formulas compared with, for example "100" or "$D$1"
+	Formula1, Formula2 string
+
+	// Formatting of the cells matching a cellIs rule. Only the font
+	// colour, bold, italic and fill are applied.
+	Style Style
+}
+
+// Conditional format as written to the sheet XML
+type conditionData struct {
+	Type     string
+	Range    string
+	Priority int
+	Colors   []string
+	Operator string
+	Formula1 string
+	Formula2 string
+	DxfID    int
+}
+
+var cellIsOperators = map[string]bool{"equal": true, "notEqual": true, "greaterThan": true, "greaterThanOrEqual": true, "lessThan": true, "lessThanOrEqual": true, "between": true, "notBetween": true}
+
+// Format a range of cells depending on their values
+func (s *Sheet) AddConditionalFormat(f ConditionalFormat) error {
+	_, err := f.data()
+	if err != nil {
+		return err
+	}
+
+	s.conditionalFormats = append(s.conditionalFormats, f)
+
+	return nil
+}
+
+func (f ConditionalFormat) data() (conditionData, error) {
+	d := conditionData{
+		Type:  f.Type.String(),
+		Range: strings.ToUpper(f.Range),
+	}
+
+	if !rangePattern.MatchString(f.Range) {
+		return d, fmt.Errorf("invalid conditional format range %q", f.Range)
+	}
+
+	var colors []string
+	switch f.Type {
+	case ConditionColorScale:
+		if f.MinColor == "" || f.MaxColor == "" {
+			return d, errors.New("colour scale needs a MinColor and a MaxColor")
+		}
+		colors = []string{f.MinColor, f.MidColor, f.MaxColor}
+		if f.MidColor == "" {
+			colors = []string{f.MinColor, f.MaxColor}
+		}
+	case ConditionDataBar:
+		if f.Color == "" {
+			return d, errors.New("data bar needs a Color")
+		}
+		colors = []string{f.Color}
+	case ConditionCellIs:
+		if !cellIsOperators[f.Operator] {
+			return d, fmt.Errorf("invalid conditional format operator %q", f.Operator)
+		}
+		between := f.Operator == "between" || f.Operator == "notBetween"
+		if f.Formula1 == "" || between && f.Formula2 == "" {
+			return d, fmt.Errorf("%s rule needs a formula for each value compared", f.Operator)
+		}
+		err := f.Style.validate()
+		if err != nil {
+			return d, err
+		}
+		d.Operator = f.Operator
+		d.Formula1 = strings.TrimPrefix(f.Formula1, "=")
+		if between {
+			d.Formula2 = strings.TrimPrefix(f.Formula2, "=")
+		}
+	default:
+		return d, fmt.Errorf("invalid conditional format type %d", f.Type)
+	}
+
+	for _, c := range colors {
+		if !colorPattern.MatchString(c) {
+			return d, fmt.Errorf("invalid conditional format colour %q", c)
+		}
+		d.Colors = append(d.Colors, argb(c))
+	}
+
+	return d, nil
+}
+
+// Page setup of a printed sheet. The zero PageSetup leaves the printer's
+// defaults.
+type PageSetup struct {
+	Landscape bool
+
+	// Paper size code of the Office Open XML standard, for example 1 for
+	// Letter and 9 for A4. Zero leaves the printer's default.
+	PaperSize uint
+
+	// Scale the sheet to fit this many pages wide and tall. When one of
+	// these is set, zero for the other leaves that direction unlimited:
+	// FitToWidth of 1 fits all the columns onto each page.
+	FitToWidth  uint
+	FitToHeight uint
+
+	// Page margins; Excel's defaults are used when this is nil
+	Margins *PageMargins
+}
+
+// Text of a printed header or footer, in three sections. The text may contain
+// Excel's codes, such as &P for the page number, &N for the number of pages,
+// &D for the date and &A for the sheet name; a literal ampersand is written
+// as &&. For example Center: "Page &P of &N".
+type HeaderFooter struct {
+	Left, Center, Right string
+}
+
+// The header or footer in the form of the worksheet XML, for example
+// "&LConfidential&CPage &P"
+func (h HeaderFooter) String() string {
+	s := ""
+	if h.Left != "" {
+		s += "&L" + h.Left
+	}
+	if h.Center != "" {
+		s += "&C" + h.Center
+	}
+	if h.Right != "" {
+		s += "&R" + h.Right
+	}
+	return s
+}
+
+// Page margins in inches
+type PageMargins struct {
+	Left, Right, Top, Bottom float64
+
+	// Distance of the header and footer from the edge of the page
+	Header, Footer float64
 }
 
+// Title given to new sheets. Within a workbook, sheets with the same title
+// are numbered to keep their titles unique: "Data", "Data2", "Data3" and so on.
+var DefaultSheetTitle = "Data"
+
 // Create a sheet with no dimensions
 func NewSheet() Sheet {
 	c := make([]Column, 0)
@@ -67,7 +958,7 @@ func NewSheet() Sheet {
 	sst := make([]string, 0)
 
 	s := Sheet{
-		Title:           "Data",
+		Title:           DefaultSheetTitle,
 		columns:         c,
 		rows:            r,
 		sharedStringMap: ssm,
@@ -84,7 +975,7 @@ func NewSheetWithColumns(c []Column) Sheet {
 	sst := make([]string, 0)
 
 	s := Sheet{
-		Title:           "Data",
+		Title:           DefaultSheetTitle,
 		columns:         c,
 		rows:            r,
 		sharedStringMap: ssm,
@@ -100,16 +991,42 @@ func NewSheetWithColumns(c []Column) Sheet {
 	return s
 }
 
-// Create a new row with a length caculated by the sheets known column count
+// Register the style for the cells of this sheet, returning the StyleID by
+// which cells refer to it. Registering an equal style again returns the same
+// StyleID.
+func (s *Sheet) AddStyle(st Style) StyleID {
+	for i, e := range s.styles {
+		if e == st {
+			return firstCustomStyle + StyleID(i)
+		}
+	}
+
+	s.styles = append(s.styles, st)
+
+	return firstCustomStyle + StyleID(len(s.styles)-1)
+}
+
+// Register the style of integers with thousands separators, for example
+// 1,234,567
+func (s *Sheet) NewThousandsStyle() StyleID {
+	return s.AddStyle(Style{NumberFormat: FormatThousands})
+}
+
+// Create a new row with a length caculated by the sheets known column count.
+// Each cell has the DefaultType of its column.
 func (s *Sheet) NewRow() Row {
 	c := make([]Cell, len(s.columns))
+	for i, col := range s.columns {
+		c[i].Type = col.DefaultType
+	}
 	r := Row{
 		Cells: c,
 	}
 	return r
 }
 
-// Append a row to the sheet
+// Append a row to the sheet. AppendRow must not be called concurrently with
+// other methods of the sheet.
 func (s *Sheet) AppendRow(r Row) error {
 	if len(r.Cells) != len(s.columns) {
 		return fmt.Errorf("the given row has %d cells and %d were expected", len(r.Cells), len(s.columns))
@@ -118,330 +1035,2211 @@ func (s *Sheet) AppendRow(r Row) error {
 	cells := make([]Cell, len(s.columns))
 
 	for n, c := range r.Cells {
-		cells[n].Type = c.Type
-		cells[n].Value = c.Value
-
-		if cells[n].Type == CellTypeString {
-			// calculate string reference
-			cells[n].Value = html.EscapeString(cells[n].Value)
-			i, exists := s.sharedStringMap[cells[n].Value]
-			if !exists {
-				i = len(s.sharedStrings)
-				s.sharedStringMap[cells[n].Value] = i
-				s.sharedStrings = append(s.sharedStrings, cells[n].Value)
-			}
-			cells[n].Value = strconv.Itoa(i)
+		if c.Type == CellTypeNumber && c.Value == "" {
+			c.Type = s.columns[n].DefaultType
 		}
+		cells[n] = s.sharedCell(c)
 	}
 
 	row := s.NewRow()
 	row.Cells = cells
+	row.Height = r.Height
+	row.OutlineLevel = r.OutlineLevel
 
 	s.rows = append(s.rows, row)
 
 	return nil
 }
 
-// Get the Shared Strings in the order they were added to the map
-func (s *Sheet) SharedStrings() []string {
-	return s.sharedStrings
+// Append rows to the sheet, for example rows built by several goroutines
+// and collected in one. No row is appended if any has the wrong number of
+// cells.
+func (s *Sheet) AppendRows(rows []Row) error {
+	for i, r := range rows {
+		if len(r.Cells) != len(s.columns) {
+			return fmt.Errorf("row %d has %d cells and %d were expected", i+1, len(r.Cells), len(s.columns))
+		}
+	}
+
+	for _, r := range rows {
+		err := s.AppendRow(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// Given zero-based array indices output the Excel cell reference. For
-// example (0,0) => "A1"; (2,2) => "C3"; (26,45) => "AA46"
-func CellIndex(x, y uint64) (string, uint64) {
-	return colName(x), (y + 1)
+// Builds a row of a sheet by setting its cells by column name, for example
+//
+//	err := s.BuildRow().Set("Name", NewStringCell("Ada")).Set("Age", NewIntCell(36)).Append()
+//
+// The first error, such as an unknown column name, is returned by Row and
+// Append.
+type RowBuilder struct {
+	sheet *Sheet
+	row   Row
+	err   error
 }
 
-// From a zero-based column number return the Excel column name.
-// For example: 0 => "A"; 2 => "C"; 26 => "AA"
-func colName(n uint64) string {
-	var s string
-	n += 1
+// Start building a row of the sheet from NewRow
+func (s *Sheet) BuildRow() *RowBuilder {
+	return &RowBuilder{sheet: s, row: s.NewRow()}
+}
 
-	for n > 0 {
-		n -= 1
-		s = string(65+(n%26)) + s
-		n /= 26
+// Set the cell of the first column with the given name
+func (b *RowBuilder) Set(name string, c Cell) *RowBuilder {
+	if b.err != nil {
+		return b
 	}
 
-	return s
-}
+	for i, col := range b.sheet.columns {
+		if col.Name == name {
+			b.row.Cells[i] = c
+			return b
+		}
+	}
 
-// Convert time to the OLE Automation format.
-func OADate(d time.Time) string {
-	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
-	nsPerDay := 24 * time.Hour
+	b.err = fmt.Errorf("the sheet has no column named %q", name)
 
-	v := -1 * float64(epoch.Sub(d)) / float64(nsPerDay)
+	return b
+}
 
-	// TODO: deal with dates before epoch
-	// e.g. http://stackoverflow.com/questions/15549823/oadate-to-milliseconds-timestamp-in-javascript/15550284#15550284
+// The row built
+func (b *RowBuilder) Row() (Row, error) {
+	return b.row, b.err
+}
 
-	if d.Hour() == 0 && d.Minute() == 0 && d.Second() == 0 {
-		return fmt.Sprintf("%d", int64(v))
-	} else {
-		return fmt.Sprintf("%f", v)
+// Append the row built to the sheet
+func (b *RowBuilder) Append() error {
+	if b.err != nil {
+		return b.err
 	}
+
+	return b.sheet.AppendRow(b.row)
+}
+
+// Mark the columns with the given zero-based indices as text columns, in
+// which every cell is held as text in the text ("@") format
+func (s *Sheet) SetTextColumns(indices ...int) error {
+	for _, i := range indices {
+		if i < 0 || i >= len(s.columns) {
+			return fmt.Errorf("column %d is outside the %d columns of the sheet", i, len(s.columns))
+		}
+	}
+
+	for _, i := range indices {
+		s.columns[i].Text = true
+	}
+
+	return nil
+}
+
+// Repeat the rows with the given zero-based indices, from and to inclusive,
+// at the top of every printed page. RepeatRows(0, 0) repeats the first row.
+func (s *Sheet) RepeatRows(from, to int) error {
+	if from < 0 || to < from || to >= maxRows {
+		return fmt.Errorf("invalid rows %d to %d to repeat", from, to)
+	}
+
+	s.printTitleRows = fmt.Sprintf("$%d:$%d", from+1, to+1)
+
+	return nil
+}
+
+// Style the sheet as a report: a bold header row of the column names is
+// inserted before the rows of the sheet and frozen, the rows written are
+// given filter dropdowns unless AutoFilter is set, and the columns are sized
+// to fit their content as by AutoWidth. Rows appended afterwards are
+// included in the filter.
+func (s *Sheet) ApplyReportStyle() error {
+	bold := s.AddStyle(Style{Font: Font{Bold: true}})
+
+	header := make([]Cell, len(s.columns))
+	for i, col := range s.columns {
+		header[i] = NewStringCell(col.Name)
+		header[i].Style = bold
+	}
+
+	rows := s.rows
+	s.rows = nil
+	err := s.AppendRow(Row{Cells: header})
+	if err != nil {
+		s.rows = rows
+		return err
+	}
+	s.rows = append(s.rows, rows...)
+
+	s.FreezeRows = 1
+	s.AutoWidth = true
+	s.filterRows = true
+
+	return nil
+}
+
+// Replace the value of a string cell with a reference to the shared string
+// table. Cells of other types are returned unchanged.
+func (s *Sheet) sharedCell(c Cell) Cell {
+	if c.Type != CellTypeString {
+		return c
+	}
+
+	// calculate string reference
+	c.Value = html.EscapeString(c.Value)
+	i, exists := s.sharedStringMap[c.Value]
+	if !exists {
+		i = len(s.sharedStrings)
+		s.sharedStringMap[c.Value] = i
+		s.sharedStrings = append(s.sharedStrings, c.Value)
+	}
+	c.Value = strconv.Itoa(i)
+	c.shared = true
+
+	return c
+}
+
+// Set the value of the cell at the given zero-based column and row, inferring
+// the cell type as TypedCell does. Rows are added to the sheet as needed.
+func (s *Sheet) SetCellValue(col, row int, v interface{}) error {
+	if col < 0 || col >= len(s.columns) {
+		return fmt.Errorf("column %d is outside the %d columns of the sheet", col, len(s.columns))
+	}
+
+	if row < 0 {
+		return fmt.Errorf("row %d is not a valid row index", row)
+	}
+
+	for len(s.rows) <= row {
+		s.rows = append(s.rows, s.NewRow())
+	}
+
+	s.rows[row].Cells[col] = s.sharedCell(TypedCell(v))
+
+	return nil
+}
+
+// Get the value of the cell at the given zero-based column and row. Numbers
+// are returned as float64, booleans as bool, datetimes as time.Time and
+// strings as string. A cell which has not been set returns nil.
+func (s *Sheet) GetCellValue(col, row int) (interface{}, error) {
+	if col < 0 || col >= len(s.columns) || row < 0 || row >= len(s.rows) {
+		x, y := CellIndex(uint64(col), uint64(row))
+		return nil, fmt.Errorf("cell %s%d is outside the sheet", x, y)
+	}
+
+	c := s.rows[row].Cells[col]
+
+	switch c.Type {
+	case CellTypeString:
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(s.sharedStrings) {
+			return nil, fmt.Errorf("invalid shared string reference %q", c.Value)
+		}
+		return html.UnescapeString(s.sharedStrings[i]), nil
+	case CellTypeInlineString:
+		return c.Value, nil
+	case CellTypeBool:
+		return c.Value == "1", nil
+	case CellTypeDatetime, CellTypeDate:
+		if !c.Time.IsZero() {
+			return c.Time, nil
+		}
+		return time.Parse(time.RFC3339, c.Value)
+	case CellTypeFormula:
+		return c.Value, nil
+	}
+
+	if c.Value == "" {
+		return nil, nil
+	}
+
+	return strconv.ParseFloat(c.Value, 64)
+}
+
+// Maximum number of characters Excel allows in a cell
+const maxCellLength = 32767
+
+// Maximum number of rows Excel allows in a sheet
+const maxRows = 1048576
+
+// Maximum outline level of a row or column
+const maxOutlineLevel = 7
+
+// Maximum number of characters Excel allows in a sheet title
+const maxSheetTitle = 31
+
+// Characters which Excel does not allow in a sheet title
+const invalidTitleChars = `[]:*?/\`
+
+// Check that the title is one Excel allows for a sheet
+func checkSheetTitle(title string) error {
+	if title == "" {
+		return errors.New("the sheet title is empty")
+	}
+	if utf8.RuneCountInString(title) > maxSheetTitle {
+		return fmt.Errorf("sheet title %q is longer than %d characters", title, maxSheetTitle)
+	}
+	if strings.ContainsAny(title, invalidTitleChars) {
+		return fmt.Errorf("sheet title %q contains one of the characters %s", title, invalidTitleChars)
+	}
+	return nil
+}
+
+// The title shortened so that it fits within the maximum length of a sheet
+// title together with the given suffix
+func titleWithSuffix(title, suffix string) string {
+	n := maxSheetTitle - utf8.RuneCountInString(suffix)
+	if utf8.RuneCountInString(title) > n {
+		title = string([]rune(title)[:n])
+	}
+	return title + suffix
+}
+
+// Check every row of the sheet, returning all of the problems found. Rows must
+// have a cell for every column, number, datetime and boolean cells must hold
+// values of that type, and text must be valid XML no longer than Excel's limit
+// of 32767 characters.
+func (s *Sheet) Validate() []error {
+	errs := make([]error, 0)
+
+	err := checkPrintArea(s)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for i, r := range s.rows {
+		if len(r.Cells) != len(s.columns) {
+			errs = append(errs, fmt.Errorf("row %d has %d cells and %d were expected", i+1, len(r.Cells), len(s.columns)))
+		}
+
+		for j, c := range r.Cells {
+			if c.Type == CellTypeString {
+				v, err := s.GetCellValue(j, i)
+				if err == nil {
+					c.Value = v.(string)
+				}
+			}
+
+			err := validateCell(c)
+			if err != nil {
+				x, y := CellIndex(uint64(j), uint64(i))
+				errs = append(errs, fmt.Errorf("cell %s%d: %s", x, y, err.Error()))
+			}
+		}
+	}
+
+	return errs
+}
+
+// Check that the print area of the sheet, if any, is a range of cells
+func checkPrintArea(s *Sheet) error {
+	if s.PrintArea != "" && !rangePattern.MatchString(s.PrintArea) {
+		return fmt.Errorf("invalid print area %q for sheet %q", s.PrintArea, s.Title)
+	}
+	return nil
+}
+
+var decimalPattern = regexp.MustCompile(`^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+
+// Parse a finite decimal number, as written in a cell. Unlike
+// strconv.ParseFloat, hexadecimal numbers, underscores, NaN and infinities
+// are not accepted.
+func parseDecimal(v string) (float64, error) {
+	if !decimalPattern.MatchString(v) {
+		return 0, fmt.Errorf("invalid number %q", v)
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid number %q", v)
+	}
+	return f, nil
+}
+
+// Check that the value of a cell is valid for its type
+func validateCell(c Cell) error {
+	switch c.Type {
+	case CellTypeNumber, CellTypePercent:
+		if c.Value == "" {
+			return nil
+		}
+		_, err := parseDecimal(c.Value)
+		if err != nil {
+			return err
+		}
+	case CellTypeDatetime, CellTypeDate:
+		if !c.Time.IsZero() {
+			return nil
+		}
+		_, err := time.Parse(time.RFC3339, c.Value)
+		if err != nil {
+			return fmt.Errorf("invalid RFC3339 datetime %q", c.Value)
+		}
+	case CellTypeBool:
+		if c.Value != "0" && c.Value != "1" {
+			return fmt.Errorf("invalid boolean %q", c.Value)
+		}
+	case CellTypeString, CellTypeInlineString:
+		if !utf8.ValidString(c.Value) {
+			return fmt.Errorf("text is not valid UTF-8")
+		}
+		if n := utf8.RuneCountInString(c.Value); n > maxCellLength {
+			return fmt.Errorf("text has %d characters and at most %d are allowed", n, maxCellLength)
+		}
+		for _, r := range c.Value {
+			if !validXMLChar(r) {
+				return fmt.Errorf("text contains the illegal character %U", r)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Report whether the character may appear in an XML 1.0 document
+func validXMLChar(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		(r >= 0x20 && r <= 0xD7FF) ||
+		(r >= 0xE000 && r <= 0xFFFD) ||
+		(r >= 0x10000 && r <= 0x10FFFF)
+}
+
+// Get the Shared Strings in the order they were added to the map
+func (s *Sheet) SharedStrings() []string {
+	return s.sharedStrings
+}
+
+// Given zero-based array indices output the Excel cell reference. For
+// example (0,0) => "A1"; (2,2) => "C3"; (26,45) => "AA46"
+func CellIndex(x, y uint64) (string, uint64) {
+	return colName(x), (y + 1)
+}
+
+// From a zero-based column number return the Excel column name.
+// For example: 0 => "A"; 2 => "C"; 26 => "AA"
+func colName(n uint64) string {
+	var s string
+	n += 1
+
+	for n > 0 {
+		n -= 1
+		s = string(rune(65+(n%26))) + s
+		n /= 26
+	}
+
+	return s
+}
+
+var (
+	plainSheetName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	cellLikeName   = regexp.MustCompile(`^(?i:[A-Z]{1,3}[0-9]+|(R[0-9]*)?(C[0-9]*)?)$`)
+)
+
+// Build a cross-sheet reference for use in formulas. The sheet name is
+// single-quoted when Excel requires it, with embedded apostrophes doubled.
+// For example ("Data", "A1") => "Data!A1"; ("My Sheet", "A1") => "'My Sheet'!A1"
+func QuoteSheetRef(sheetName, cellRef string) string {
+	if plainSheetName.MatchString(sheetName) && !cellLikeName.MatchString(sheetName) {
+		return sheetName + "!" + cellRef
+	}
+
+	return "'" + strings.Replace(sheetName, "'", "''", -1) + "'!" + cellRef
+}
+
+// Absolute reference to a range on a sheet, for use in defined names. For
+// example ("My Sheet", "A1:C3") => "'My Sheet'!$A$1:$C$3"
+func sheetRef(sheetName, ref string) string {
+	return QuoteSheetRef(sheetName, cellRefPattern.ReplaceAllString(ref, "$$$1$$$2"))
+}
+
+var cellRefPattern = regexp.MustCompile(`\$?([A-Za-z]{1,3})\$?([0-9]+)`)
+
+// Convert time to the OLE Automation format. Dates before the epoch of
+// 1899-12-30 have a negative whole number of days and a positive time of day,
+// which is stored as the magnitude of the fraction: 1899-12-29 06:00 is -1.25.
+// Note that Excel's 1900 date system does not display dates before 1900.
+//
+// Excel dates have no time zone, so the date is of the wall clock time of d in
+// its location: 2020-01-01T00:00:00+09:00 is 2020-01-01 00:00, whatever the
+// time in UTC. Convert d with In first for the time in another location.
+func OADate(d time.Time) string {
+	return dateSerial(d, time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC))
+}
+
+// Convert time to a date of the 1904 date system, the number of days since
+// 1904-01-01. As with OADate, this is the wall clock time of d.
+func OADate1904(d time.Time) string {
+	return dateSerial(d, time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+// Convert the wall clock time to the number of days since the epoch. The
+// difference is taken in seconds, as a time.Duration only spans about 292
+// years.
+func dateSerial(d time.Time, epoch time.Time) string {
+	secondsPerDay := float64(24 * 60 * 60)
+
+	d = time.Date(d.Year(), d.Month(), d.Day(), d.Hour(), d.Minute(), d.Second(), d.Nanosecond(), time.UTC)
+
+	seconds := float64(d.Unix()-epoch.Unix()) + float64(d.Nanosecond())/1e9
+	v := seconds / secondsPerDay
+
+	if v < 0 {
+		days := math.Floor(v)
+		v = days - (v - days)
+	}
+
+	if d.Hour() == 0 && d.Minute() == 0 && d.Second() == 0 {
+		return fmt.Sprintf("%d", int64(v))
+	} else {
+		return fmt.Sprintf("%f", v)
+	}
+}
+
+// Create filename and save the XLSX file
+func (s *Sheet) SaveToFile(filename string) error {
+	outputfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outputfile.Close()
+	w := bufio.NewWriter(outputfile)
+	err = s.SaveToWriter(w)
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Save the rows of the sheet across several XLSX files of at most n rows
+// each, for example to keep files under an email size limit. The names of
+// the files are made by formatting the one-based file number with pattern,
+// such as "report_%d.xlsx", and are returned in order. Every file has the
+// columns of the sheet and starts with its first headerRows rows, which do
+// not count towards n.
+func (s *Sheet) SaveToFiles(pattern string, n int, headerRows int) ([]string, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("the number of rows per file must be positive, got %d", n)
+	}
+
+	if headerRows < 0 || headerRows > len(s.rows) {
+		return nil, fmt.Errorf("the sheet has %d rows and %d header rows were given", len(s.rows), headerRows)
+	}
+
+	header := s.rows[:headerRows]
+	body := s.rows[headerRows:]
+	filenames := make([]string, 0)
+
+	for start := 0; start == 0 || start < len(body); start += n {
+		end := start + n
+		if end > len(body) {
+			end = len(body)
+		}
+
+		part := *s
+		part.rows = make([]Row, 0, len(header)+end-start)
+		part.rows = append(part.rows, header...)
+		part.rows = append(part.rows, body[start:end]...)
+
+		filename := fmt.Sprintf(pattern, len(filenames)+1)
+		err := part.SaveToFile(filename)
+		if err != nil {
+			return filenames, err
+		}
+		filenames = append(filenames, filename)
+	}
+
+	return filenames, nil
+}
+
+// Save the XLSX file to the given writer
+func (s *Sheet) SaveToWriter(w io.Writer) error {
+
+	ww := NewWorkbookWriter(w)
+
+	err := ww.writeSheet(s)
+	if err != nil {
+		return err
+	}
+
+	err = ww.Close()
+
+	return err
+}
+
+// Write a sheet held in memory to the workbook. Its dimension and totals are
+// known before its rows are written.
+func (ww *WorkbookWriter) writeSheet(s *Sheet) error {
+	dimension := dimensionRef(uint64(len(s.columns)), uint64(len(s.rows)))
+
+	sw, err := ww.newSheetWriter(s, dimension)
+	if err != nil {
+		return err
+	}
+
+	if s.TotalRow {
+		sw.totalRow = uint64(len(s.rows))
+	}
+
+	return sw.WriteRows(s.rows)
+}
+
+// Errors returned on misuse of a WorkbookWriter or SheetWriter
+var (
+	ErrWorkbookClosed = errors.New("xlsx: workbook writer is closed")
+	ErrSheetClosed    = errors.New("xlsx: sheet writer is closed")
+	ErrHeaderWritten  = errors.New("xlsx: workbook header already written")
+)
+
+// Handles the writing of an XLSX workbook
+type WorkbookWriter struct {
+	zipWriter     *zip.Writer
+	sheetWriter   *SheetWriter
+	headerWritten bool
+	closed        bool
+	ownZipWriter  bool
+	header        *Sheet
+	sheets        []*Sheet
+	stats         WriterStats
+
+	sharedStringMap map[string]int
+	sharedStrings   []string
+	sharedRefs      int
+
+	// styles registered by the sheets of the workbook, which follow the
+	// built-in cellXfs entries
+	styles []Style
+
+	// styles of the cellIs rules of conditional formats
+	dxfs []Style
+
+	// Write the rows of each sheet to a temporary file and copy them into
+	// the workbook when the sheet is closed. This allows the dimension of
+	// the sheet, which precedes its rows, to be written without holding
+	// the rows in memory. Temporary files are created in TempDir, or the
+	// default directory for temporary files when TempDir is empty.
+	BackfillDimension bool
+	TempDir           string
+
+	// Continue a sheet on a new sheet when rows are written beyond Excel's
+	// limit of 1,048,576 rows, rather than returning an error. The new
+	// sheets have the same columns and are titled "Data (2)", "Data (3)" and
+	// so on.
+	SplitSheets bool
+
+	// Reject rows written with a SheetWriter whose number of cells differs
+	// from the number of columns of the sheet, as AppendRow does
+	StrictRows bool
+
+	// Called with the header of each part before it is added to the zip
+	// file, allowing fields such as Method, Comment and Modified to be set
+	PartHeader func(h *zip.FileHeader)
+
+	// parts are stored without compression, or compressed by compressor
+	// when it is set by SetCompressionLevel
+	storeParts bool
+	compressor zip.Compressor
+
+	// row buffer and column names of the last SheetWriter, which are
+	// reused by the next
+	buf      []byte
+	colNames []string
+
+	definedNames []definedName
+
+	// one-based numbers of the drawing parts, the number of images written
+	// and their formats
+	drawings   []int
+	mediaCount int
+	mediaTypes map[ImageFormat]bool
+
+	// temporary file written by OpenForAppend, which replaces appendTo
+	// when the workbook is closed
+	appendFile *os.File
+	appendTo   string
+}
+
+// NewWorkbookWriter creates a new WorkbookWriter, which SheetWriters will
+// operate on. It must be closed when all Sheets have been written.
+func NewWorkbookWriter(w io.Writer) *WorkbookWriter {
+	ww := &WorkbookWriter{ownZipWriter: true, sharedStringMap: make(map[string]int)}
+	ww.zipWriter = zip.NewWriter(countingWriter{w, &ww.stats.CompressedBytes})
+	return ww
+}
+
+// NewWorkbookWriterFromZip creates a new WorkbookWriter which adds the parts
+// of the workbook to the given zip.Writer. Closing the WorkbookWriter does
+// not close the zip.Writer, so other files may be added to it afterwards.
+func NewWorkbookWriterFromZip(z *zip.Writer) *WorkbookWriter {
+	return &WorkbookWriter{zipWriter: z, sharedStringMap: make(map[string]int)}
+}
+
+// Statistics of the output of a WorkbookWriter
+type WriterStats struct {
+	// Number of unique strings in the shared string table
+	SharedStrings int
+	// Number of cells written to sheets
+	Cells uint64
+	// Number of bytes written to the parts of the workbook
+	UncompressedBytes int64
+	// Number of bytes of zip output, which is complete once the
+	// WorkbookWriter is closed. This is not counted for a WorkbookWriter
+	// created with NewWorkbookWriterFromZip.
+	CompressedBytes int64
+}
+
+// Get statistics of the output written so far
+func (ww *WorkbookWriter) Stats() WriterStats {
+	return ww.stats
+}
+
+// Writer which counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
+
+// Add a part to the zip file and write the template to it
+func (ww *WorkbookWriter) writePart(name string, t *template.Template, data interface{}) error {
+	f, err := ww.createPart(name)
+	if err != nil {
+		return err
+	}
+
+	return t.Execute(f, data)
+}
+
+// Set the compression level of the parts added to the workbook after this
+// call, from flate.HuffmanOnly to flate.BestCompression. flate.NoCompression
+// stores the parts without compressing them, and flate.DefaultCompression
+// restores the default level. For a WorkbookWriter created from a zip.Writer,
+// the level applies to every file deflated by that zip.Writer.
+func (ww *WorkbookWriter) SetCompressionLevel(level int) error {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return fmt.Errorf("invalid compression level %d", level)
+	}
+
+	ww.storeParts = level == flate.NoCompression
+
+	ww.compressor = func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	}
+	ww.zipWriter.RegisterCompressor(zip.Deflate, ww.compressor)
+
+	return nil
+}
+
+// Reset the WorkbookWriter to write a new workbook to w, as if it had been
+// created by NewWorkbookWriter. Its options and compression level are kept,
+// and its buffers are reused, so that writing many small workbooks allocates
+// less. A workbook which has not been closed is discarded.
+func (ww *WorkbookWriter) Reset(w io.Writer) {
+	// temporary files of a workbook which was not closed
+	if sw := ww.sheetWriter; sw != nil && !sw.closed && sw.spool != nil {
+		sw.spool.Close()
+		os.Remove(sw.spool.Name())
+	}
+	if ww.appendFile != nil && !ww.closed {
+		ww.appendFile.Close()
+		os.Remove(ww.appendFile.Name())
+	}
+
+	if sw := ww.sheetWriter; sw != nil {
+		ww.buf = sw.buf
+		ww.colNames = sw.colNames
+	}
+
+	for i := range ww.sheets {
+		ww.sheets[i] = nil
+	}
+	for v := range ww.sharedStringMap {
+		delete(ww.sharedStringMap, v)
+	}
+	for f := range ww.mediaTypes {
+		delete(ww.mediaTypes, f)
+	}
+
+	ww.sheetWriter = nil
+	ww.headerWritten = false
+	ww.closed = false
+	ww.ownZipWriter = true
+	ww.header = nil
+	ww.sheets = ww.sheets[:0]
+	ww.stats = WriterStats{}
+	ww.sharedStrings = ww.sharedStrings[:0]
+	ww.sharedRefs = 0
+	ww.styles = ww.styles[:0]
+	ww.dxfs = ww.dxfs[:0]
+	ww.definedNames = ww.definedNames[:0]
+	ww.drawings = ww.drawings[:0]
+	ww.mediaCount = 0
+	ww.appendFile = nil
+	ww.appendTo = ""
+
+	ww.zipWriter = zip.NewWriter(countingWriter{w, &ww.stats.CompressedBytes})
+	if ww.compressor != nil {
+		ww.zipWriter.RegisterCompressor(zip.Deflate, ww.compressor)
+	}
+}
+
+// Add a part to the zip file, returning the writer for its content
+func (ww *WorkbookWriter) createPart(name string) (io.Writer, error) {
+	h := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	}
+
+	if ww.storeParts {
+		h.Method = zip.Store
+	}
+
+	if ww.PartHeader != nil {
+		ww.PartHeader(h)
+	}
+
+	f, err := ww.zipWriter.CreateHeader(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return countingWriter{f, &ww.stats.UncompressedBytes}, nil
+}
+
+// Write the header files of the workbook. The given sheet provides the
+// document properties and the workbook options, such as OmitStyles; parts
+// which list the sheets of the workbook, and the styles they use, are written
+// when it is closed.
+func (ww *WorkbookWriter) WriteHeader(s *Sheet) error {
+	if ww.closed {
+		return ErrWorkbookClosed
+	}
+
+	if ww.headerWritten {
+		return ErrHeaderWritten
+	}
+
+	err := ww.writePart("docProps/core.xml", TemplateCore, s.DocumentInfo)
+	if err != nil {
+		return err
+	}
+
+	err = ww.writePart("_rels/.rels", TemplateRelationships, nil)
+	if err != nil {
+		return err
+	}
+
+	// the header sheet's shared strings keep their indices in the workbook
+	for _, v := range s.sharedStrings {
+		ww.sharedString(v)
+	}
+
+	ww.header = s
+	ww.headerWritten = true
+
+	return nil
+}
+
+// Get the index of the string in the workbook's shared string table, adding
+// it if necessary
+func (ww *WorkbookWriter) sharedString(v string) int {
+	i, exists := ww.sharedStringMap[v]
+	if !exists {
+		i = len(ww.sharedStrings)
+		ww.sharedStringMap[v] = i
+		ww.sharedStrings = append(ww.sharedStrings, v)
+	}
+	return i
+}
+
+// Get the cellXfs index of the style in the workbook, adding it if necessary
+func (ww *WorkbookWriter) styleIndex(st Style) int {
+	for i, e := range ww.styles {
+		if e == st {
+			return builtinXfs + i
+		}
+	}
+
+	ww.styles = append(ww.styles, st)
+
+	return builtinXfs + len(ww.styles) - 1
+}
+
+// The index of the differential format of a conditional format's style,
+// registering it with the workbook if it is new
+func (ww *WorkbookWriter) dxfIndex(st Style) int {
+	for i, e := range ww.dxfs {
+		if e == st {
+			return i
+		}
+	}
+
+	ww.dxfs = append(ww.dxfs, st)
+
+	return len(ww.dxfs) - 1
+}
+
+// Data for the styles template: the number formats, fonts, fill colours and
+// cellXfs entries of the registered styles, and the differential formats of
+// conditional formats
+type stylesData struct {
+	*Sheet
+	NumFmts []numFmt
+	Fonts   []Font
+	Fills   []string
+	Xfs     []xf
+	Dxfs    []Style
+}
+
+type numFmt struct {
+	ID   int
+	Code string
+}
+
+type xf struct {
+	NumFmtID  int
+	FontID    int
+	FillID    int
+	BorderID  int
+	Aligned   bool
+	Alignment Alignment
+}
+
+// Number of fonts and fills in the styles template, which precede those of
+// the registered styles
+const (
+	builtinFonts = 3
+	builtinFills = 2
+)
+
+// Collect the number formats, fonts, fills and cellXfs entries of the
+// registered styles
+func (ww *WorkbookWriter) stylesData() stylesData {
+	d := stylesData{Sheet: ww.header, NumFmts: []numFmt{}, Fonts: []Font{}, Fills: []string{}, Xfs: []xf{}, Dxfs: []Style{}}
+
+	ids := make(map[string]int)
+	fontIDs := make(map[Font]int)
+	fillIDs := make(map[string]int)
+	for _, st := range ww.styles {
+		x := xf{FontID: 1, Aligned: st.Alignment != (Alignment{}), Alignment: st.Alignment}
+		if st.border {
+			x.BorderID = 1
+		}
+
+		if st.Font != (Font{}) {
+			f := st.Font.resolved()
+			id, exists := fontIDs[f]
+			if !exists {
+				id = builtinFonts + len(d.Fonts)
+				fontIDs[f] = id
+				d.Fonts = append(d.Fonts, f)
+			}
+			x.FontID = id
+		}
+
+		if st.Fill != "" {
+			c := argb(st.Fill)
+			id, exists := fillIDs[c]
+			if !exists {
+				id = builtinFills + len(d.Fills)
+				fillIDs[c] = id
+				d.Fills = append(d.Fills, c)
+			}
+			x.FillID = id
+		}
+
+		if st.NumberFormat != "" {
+			id, exists := ids[st.NumberFormat]
+			if builtin, ok := builtinNumFmts[st.NumberFormat]; ok {
+				id, exists = builtin, true
+			}
+			if !exists {
+				id = firstCustomNumFmt + len(d.NumFmts)
+				ids[st.NumberFormat] = id
+				d.NumFmts = append(d.NumFmts, numFmt{id, st.NumberFormat})
+			}
+			x.NumFmtID = id
+		}
+
+		d.Xfs = append(d.Xfs, x)
+	}
+
+	for _, st := range ww.dxfs {
+		if st.Font.Color != "" {
+			st.Font.Color = argb(st.Font.Color)
+		}
+		if st.Fill != "" {
+			st.Fill = argb(st.Fill)
+		}
+		d.Dxfs = append(d.Dxfs, st)
+	}
+
+	return d
+}
+
+// Data for the templates of the workbook parts which list its sheets
+type workbookData struct {
+	*Sheet
+	Sheets       []*Sheet
+	DefinedNames []definedName
+	FirstSheet   int
+	ActiveTab    int
+	Drawings     []int
+	ImageTypes   []ImageFormat
+	Application  string
+}
+
+// A name defined in the workbook, which is scoped to the sheet with index
+// SheetIndex when Scoped is set
+type definedName struct {
+	Name       string
+	RefersTo   string
+	SheetIndex int
+	Scoped     bool
+}
+
+var definedNamePattern = regexp.MustCompile(`^[\pL_\\][\pL\pN_.\\]*$`)
+
+// Define a name for the given reference or formula, without a leading "=",
+// in the scope of the whole workbook. For example ("SalesData",
+// "Data!$A$1:$D$100"); QuoteSheetRef quotes sheet names where necessary.
+// Names start with a letter, underscore or backslash, contain letters,
+// digits, underscores, periods and backslashes, must not look like cell
+// references such as "A1" or "R1C1", and are unique without regard to case.
+func (ww *WorkbookWriter) AddDefinedName(name, refersTo string) error {
+	if !definedNamePattern.MatchString(name) || cellLikeName.MatchString(name) || len(name) > 255 {
+		return fmt.Errorf("invalid defined name %q", name)
+	}
+
+	for _, n := range ww.definedNames {
+		if strings.EqualFold(n.Name, name) {
+			return fmt.Errorf("the name %q is already defined", name)
+		}
+	}
+
+	refersTo = html.EscapeString(strings.TrimPrefix(refersTo, "="))
+	ww.definedNames = append(ww.definedNames, definedName{Name: name, RefersTo: refersTo})
+
+	return nil
+}
+
+// Write the parts of the workbook which list its sheets, and the shared
+// strings collected from them
+func (ww *WorkbookWriter) writeWorkbook() error {
+	wb := workbookData{
+		Sheet:        ww.header,
+		Sheets:       ww.sheets,
+		DefinedNames: make([]definedName, 0),
+		Drawings:     ww.drawings,
+		ImageTypes:   ww.imageTypes(),
+		Application:  ww.header.DocumentInfo.Application,
+	}
+
+	if wb.Application == "" {
+		wb.Application = defaultApplication
+	}
+
+	wb.FirstSheet = -1
+	active := -1
+	for i, s := range ww.sheets {
+		if s.State > SheetVeryHidden {
+			return fmt.Errorf("invalid state %d for sheet %q", s.State, s.Title)
+		}
+		if s.State == SheetVisible && wb.FirstSheet < 0 {
+			wb.FirstSheet = i
+		}
+		if s.Active {
+			if active >= 0 {
+				return fmt.Errorf("sheets %q and %q are both active", ww.sheets[active].Title, s.Title)
+			}
+			if s.State != SheetVisible {
+				return fmt.Errorf("active sheet %q is not visible", s.Title)
+			}
+			active = i
+		}
+	}
+	if wb.FirstSheet < 0 && len(ww.sheets) > 0 {
+		return errors.New("xlsx: a workbook must have at least one visible sheet")
+	}
+	wb.ActiveTab = wb.FirstSheet
+	if active >= 0 {
+		wb.ActiveTab = active
+	}
+
+	wb.DefinedNames = append(wb.DefinedNames, ww.definedNames...)
+
+	for i, s := range ww.sheets {
+		if s.PrintArea != "" {
+			err := checkPrintArea(s)
+			if err != nil {
+				return err
+			}
+			wb.DefinedNames = append(wb.DefinedNames, definedName{"_xlnm.Print_Area", html.EscapeString(sheetRef(s.Title, s.PrintArea)), i, true})
+		}
+		if s.printTitleRows != "" {
+			wb.DefinedNames = append(wb.DefinedNames, definedName{"_xlnm.Print_Titles", html.EscapeString(QuoteSheetRef(s.Title, s.printTitleRows)), i, true})
+		}
+	}
+
+	err := ww.writePart("[Content_Types].xml", TemplateContentTypes, wb)
+	if err != nil {
+		return err
+	}
+
+	err = ww.writePart("docProps/app.xml", TemplateApp, wb)
+	if err != nil {
+		return err
+	}
+
+	err = ww.writePart("xl/workbook.xml", TemplateWorkbook, wb)
+	if err != nil {
+		return err
+	}
+
+	err = ww.writePart("xl/_rels/workbook.xml.rels", TemplateWorkbookRelationships, wb)
+	if err != nil {
+		return err
+	}
+
+	if !ww.header.OmitStyles {
+		err = ww.writePart("xl/styles.xml", TemplateStyles, ww.stylesData())
+		if err != nil {
+			return err
+		}
+	}
+
+	sst := struct {
+		Count   int
+		Strings []string
+	}{
+		Count:   ww.sharedRefs,
+		Strings: ww.sharedStrings,
+	}
+	err = ww.writePart("xl/sharedStrings.xml", TemplateStringLookups, sst)
+	if err != nil {
+		return err
+	}
+
+	ww.stats.SharedStrings = len(ww.sharedStrings)
+
+	return nil
+}
+
+// Closes the WorkbookWriter. A workbook to which no sheets were written is
+// given a single empty sheet, as Excel requires at least one.
+func (ww *WorkbookWriter) Close() error {
+	if ww.closed {
+		return ErrWorkbookClosed
+	}
+
+	// a workbook must contain at least one sheet
+	if ww.sheetWriter == nil {
+		s := NewSheetWithColumns([]Column{})
+		_, err := ww.NewSheetWriter(&s)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !ww.sheetWriter.closed {
+		err := ww.sheetWriter.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := ww.writeWorkbook()
+	if err != nil {
+		return err
+	}
+
+	ww.closed = true
+
+	if !ww.ownZipWriter {
+		return ww.zipWriter.Flush()
+	}
+
+	err = ww.zipWriter.Close()
+	if ww.appendFile == nil {
+		return err
+	}
+
+	return ww.replaceAppended(err)
+}
+
+// NewSheetWriter creates a new SheetWriter in this workbook using the given sheet.
+// It returns a SheetWriter to which rows can be written. The title must be
+// at most 31 characters without any of []:*?/\. A sheet whose title is
+// already used in the workbook is renamed by appending a number, shortening
+// the title if need be, and the sheet's Title is changed to the new title.
+// All rows must be written to the SheetWriter before the next call to NewSheetWriter,
+// as this will automatically close the previous SheetWriter.
+func (ww *WorkbookWriter) NewSheetWriter(s *Sheet) (*SheetWriter, error) {
+	if s.TotalRow {
+		return nil, errors.New("the total row of a streamed sheet must be written with WriteTotalRow")
+	}
+
+	return ww.newSheetWriter(s, "")
+}
+
+// Create a SheetWriter for the given sheet. A non-empty dimension is written
+// as the sheet's dimension when its extent is known before the rows are
+// written.
+func (ww *WorkbookWriter) newSheetWriter(s *Sheet, dimension string) (*SheetWriter, error) {
+	if ww.closed {
+		return nil, ErrWorkbookClosed
+	}
+
+	err := checkSheetTitle(s.Title)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkPrintArea(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ww.headerWritten {
+		err := ww.WriteHeader(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ww.sheetWriter != nil && !ww.sheetWriter.closed {
+		err := ww.sheetWriter.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	partName := "xl/worksheets/sheet" + strconv.Itoa(len(ww.sheets)+1) + ".xml"
+	sw := &SheetWriter{ww: ww, sheet: s, partName: partName, buf: ww.buf, colNames: ww.colNames}
+	if prev := ww.sheetWriter; prev != nil {
+		sw.buf = prev.buf
+		sw.colNames = prev.colNames
+	}
+
+	// the sheet is only added to the workbook once it can be written to
+	if ww.BackfillDimension || s.AutoWidth {
+		spool, err := ioutil.TempFile(ww.TempDir, "xlsx-sheet")
+		if err != nil {
+			return nil, err
+		}
+		sw.spool = spool
+		sw.spoolWriter = bufio.NewWriter(spool)
+		sw.f = sw.spoolWriter
+	} else {
+		f, err := ww.createPart(partName)
+		if err != nil {
+			return nil, err
+		}
+		sw.f = f
+	}
+
+	if s.TotalColumn {
+		sw.totalColumn = uint64(len(s.columns))
+	}
+
+	s.Title = ww.uniqueSheetName(s.Title)
+	ww.sheets = append(ww.sheets, s)
+	ww.sheetWriter = sw
+
+	if sw.spool != nil {
+		return sw, nil
+	}
+
+	err = sw.writeSheetStart(sw.f, s, dimension)
+
+	return sw, err
+}
+
+// Number the given sheet title if it is already used in the workbook,
+// shortening it to keep the numbered title within the maximum length. Excel
+// compares sheet titles without regard to case.
+func (ww *WorkbookWriter) uniqueSheetName(title string) string {
+	used := make(map[string]bool)
+	for _, s := range ww.sheets {
+		used[strings.ToLower(s.Title)] = true
+	}
+
+	name := title
+	for i := 2; used[strings.ToLower(name)]; i++ {
+		name = titleWithSuffix(title, strconv.Itoa(i))
+	}
+
+	return name
+}
+
+// Handles the writing of a sheet
+type SheetWriter struct {
+	f            io.Writer
+	ww           *WorkbookWriter
+	sheet        *Sheet
+	partName     string
+	spool        *os.File
+	spoolWriter  *bufio.Writer
+	currentIndex uint64
+	maxNCols     uint64
+	widths       []uint64
+	totalRow     uint64
+	totalColumn  uint64
+	mergeCells   []mergeRange
+	closed       bool
+
+	// highest outline level of the rows written
+	outlineLevel uint
+
+	// buffer in which each row is built, and the names of the columns
+	buf      []byte
+	colNames []string
+
+	// title of the first sheet and the number of sheets the rows have been
+	// split over after it
+	splitTitle string
+	splits     int
+}
+
+// Write a single row to this SheetWriter, as WriteRows does
+func (sw *SheetWriter) WriteRow(r Row) error {
+	rows := [1]Row{r}
+	return sw.WriteRows(rows[:])
+}
+
+// Number of rows written to this SheetWriter
+func (sw *SheetWriter) RowsWritten() uint64 {
+	return sw.currentIndex
+}
+
+// Write the given rows to this SheetWriter. Number, boolean and datetime
+// cells whose values are not of their type are rejected with an error, as
+// they would otherwise corrupt the file. Rows beyond Excel's row limit are an
+// error unless the WorkbookWriter's SplitSheets is set. When its StrictRows is
+// set, no rows are written if any has the wrong number of cells.
+func (sw *SheetWriter) WriteRows(rows []Row) error {
+	if sw.closed {
+		return ErrSheetClosed
+	}
+
+	if sw.ww.StrictRows {
+		for i, r := range rows {
+			if len(r.Cells) != len(sw.sheet.columns) {
+				return fmt.Errorf("row %d has %d cells and %d were expected", sw.currentIndex+uint64(i)+1, len(r.Cells), len(sw.sheet.columns))
+			}
+		}
+	}
+
+	if uint64(len(rows)) > maxRows-sw.currentIndex && !sw.ww.SplitSheets {
+		return fmt.Errorf("writing %d rows would exceed the limit of %d rows in a sheet", len(rows), maxRows)
+	}
+
+	for uint64(len(rows)) > maxRows-sw.currentIndex {
+		n := maxRows - sw.currentIndex
+		err := sw.writeRows(rows[:n])
+		if err != nil {
+			return err
+		}
+		rows = rows[n:]
+
+		err = sw.splitSheet()
+		if err != nil {
+			return err
+		}
+	}
+
+	return sw.writeRows(rows)
+}
+
+// Close the sheet and continue writing to a new sheet of the workbook with
+// the same columns
+func (sw *SheetWriter) splitSheet() error {
+	err := sw.Close()
+	if err != nil {
+		return err
+	}
+
+	if sw.splits == 0 {
+		sw.splitTitle = sw.sheet.Title
+	}
+
+	s := *sw.sheet
+	s.Title = titleWithSuffix(sw.splitTitle, fmt.Sprintf(" (%d)", sw.splits+2))
+	s.rows = nil
+	s.images = nil
+	s.dataValidations = nil
+	s.conditionalFormats = nil
+	s.printTitleRows = ""
+
+	// the ranges of the sheet and its selection are not carried over to
+	// the continuation sheets
+	s.Active = false
+	s.PrintArea = ""
+	s.AutoFilter = ""
+
+	next, err := sw.ww.newSheetWriter(&s, "")
+	if err != nil {
+		return err
+	}
+
+	next.splitTitle = sw.splitTitle
+	next.splits = sw.splits + 1
+	*sw = *next
+	sw.ww.sheetWriter = sw
+
+	return nil
+}
+
+// Write rows which are within the row limit of the sheet. Each row is built
+// in a buffer which is reused for the following rows.
+func (sw *SheetWriter) writeRows(rows []Row) error {
+	for _, r := range rows {
+		y := sw.currentIndex
+
+		if r.OutlineLevel > maxOutlineLevel {
+			return fmt.Errorf("row %d has outline level %d and at most %d is allowed", y+1, r.OutlineLevel, maxOutlineLevel)
+		}
+
+		// state restored when a cell of the row is rejected, so that none
+		// of the row is written and it can be written again
+		merges, refs, cells := len(sw.mergeCells), sw.ww.sharedRefs, sw.ww.stats.Cells
+		strs := len(sw.ww.sharedStrings)
+		maxNCols, outlineLevel := sw.maxNCols, sw.outlineLevel
+
+		if sw.maxNCols < uint64(len(r.Cells)) {
+			sw.maxNCols = uint64(len(r.Cells))
+		}
+
+		b := append(sw.buf[:0], `<row r="`...)
+		b = strconv.AppendUint(b, y+1, 10)
+		b = append(b, '"')
+		if r.Height > 0 {
+			b = append(b, ` ht="`...)
+			b = strconv.AppendFloat(b, r.Height, 'f', -1, 64)
+			b = append(b, `" customHeight="1"`...)
+		}
+		if r.OutlineLevel > 0 {
+			b = append(b, ` outlineLevel="`...)
+			b = strconv.AppendUint(b, uint64(r.OutlineLevel), 10)
+			b = append(b, '"')
+			if r.OutlineLevel > sw.outlineLevel {
+				sw.outlineLevel = r.OutlineLevel
+			}
+		}
+		b = append(b, '>')
+
+		for j, c := range r.Cells {
+			var err error
+			b, err = sw.appendCell(b, r, j, y, c)
+			if err != nil {
+				sw.buf = b
+				sw.mergeCells = sw.mergeCells[:merges]
+				sw.ww.sharedRefs, sw.ww.stats.Cells = refs, cells
+				for _, v := range sw.ww.sharedStrings[strs:] {
+					delete(sw.ww.sharedStringMap, v)
+				}
+				sw.ww.sharedStrings = sw.ww.sharedStrings[:strs]
+				sw.maxNCols, sw.outlineLevel = maxNCols, outlineLevel
+				return err
+			}
+		}
+
+		b = append(b, "</row>"...)
+		sw.buf = b
+
+		_, err := sw.f.Write(b)
+		if err != nil {
+			return err
+		}
+
+		sw.currentIndex++
+	}
+
+	return nil
 }
 
-// Create filename and save the XLSX file
-func (s *Sheet) SaveToFile(filename string) error {
-	outputfile, err := os.Create(filename)
-	if err != nil {
-		return err
+// Append the XML of cell j of the row with zero-based index y to b
+func (sw *SheetWriter) appendCell(b []byte, r Row, j int, y uint64, c Cell) ([]byte, error) {
+	if c.Colspan > 1 || c.Rowspan > 1 {
+		m := mergeRange{uint64(j), y, uint64(j), y}
+
+		if c.Colspan > 1 {
+			if uint64(j)+c.Colspan > uint64(len(r.Cells)) {
+				return b, fmt.Errorf("cell %s%d spans %d columns but the row has only %d cells from it", sw.colName(j), y+1, c.Colspan, uint64(len(r.Cells)-j))
+			}
+			m.x2 += c.Colspan - 1
+		}
+		if c.Rowspan > 1 {
+			m.y2 += c.Rowspan - 1
+		}
+
+		// Excel refuses to open a sheet with overlapping merges
+		for _, o := range sw.mergeCells {
+			if m.overlaps(o) {
+				return b, fmt.Errorf("merged cells %s overlap the merged cells %s", m, o)
+			}
+		}
+
+		sw.mergeCells = append(sw.mergeCells, m)
+	}
+
+	// a zero Cell has not been set and is left empty
+	if c.Type == CellTypeNumber && c.Value == "" {
+		return b, nil
+	}
+
+	if sw.sheet.AutoWidth && c.Colspan <= 1 {
+		sw.fitWidth(j, c)
+	}
+
+	cellX, cellY := sw.colName(j), y+1
+
+	text := j < len(sw.sheet.columns) && sw.sheet.columns[j].Text
+	if text && c.Type != CellTypeString && c.Type != CellTypeFormula {
+		c.Type = CellTypeInlineString
+	}
+
+	// values written as they are must not break the XML of the sheet
+	// or the file would be unreadable
+	if c.Type == CellTypeNumber || c.Type == CellTypePercent || c.Type == CellTypeBool {
+		if err := validateCell(c); err != nil {
+			return b, fmt.Errorf("cell %s%d: %s", cellX, cellY, err.Error())
+		}
+	}
+
+	dated := c.Type == CellTypeDatetime || c.Type == CellTypeDate
+	if dated && !c.Time.IsZero() {
+		c.Value = OADate(c.Time)
+		if sw.ww.header.Date1904 {
+			c.Value = OADate1904(c.Time)
+		}
+	} else if dated {
+		d, err := time.Parse(time.RFC3339, c.Value)
+		if err == nil {
+			c.Value = OADate(d)
+			if sw.ww.header.Date1904 {
+				c.Value = OADate1904(d)
+			}
+		} else if _, err := parseDecimal(c.Value); err != nil {
+			return b, fmt.Errorf("cell %s%d: invalid datetime %q", cellX, cellY, c.Value)
+		}
+	} else if c.Type == CellTypeInlineString && c.Rich != nil {
+		v, err := c.Rich.xml()
+		if err != nil {
+			return b, fmt.Errorf("cell %s%d: %s", cellX, cellY, err.Error())
+		}
+		c.Value = v
+	} else if c.Type == CellTypeInlineString {
+		c.Value = html.EscapeString(c.Value)
+	} else if c.Type == CellTypeFormula {
+		c.Value = formulaContent(c)
+	}
+
+	// index of the string in the workbook's shared string table
+	shared := -1
+	if c.Type == CellTypeString && c.shared {
+		i, err := sw.sharedStringIndex(c.Value)
+		if err != nil {
+			return b, fmt.Errorf("cell %s%d: %s", cellX, cellY, err.Error())
+		}
+		shared = i
+		sw.ww.sharedRefs++
+	} else if c.Type == CellTypeString {
+		// text streamed without being added to the sheet first
+		shared = sw.ww.sharedString(html.EscapeString(c.Value))
+		sw.ww.sharedRefs++
+	} else if c.Type == CellTypeInlineString && sw.sheet.ShareInlineStrings && c.Rich == nil {
+		c.Type = CellTypeString
+		shared = sw.ww.sharedString(c.Value)
+		sw.ww.sharedRefs++
+	}
+
+	// the type attribute and the elements around the value
+	var t, open, close string
+	var style int
+
+	switch c.Type {
+	case CellTypeString:
+		t, open, close = ` t="s"`, "<v>", "</v>"
+		style = 1
+	case CellTypeInlineString:
+		t, open, close = ` t="inlineStr"`, "<is><t>", "</t></is>"
+		if c.Rich != nil {
+			open, close = "<is>", "</is>"
+		}
+	case CellTypeNumber:
+		t, open, close = ` t="n"`, "<v>", "</v>"
+		style = 1
+		if j < len(sw.sheet.columns) {
+			style = sw.columnStyle(sw.sheet.columns[j])
+		}
+	case CellTypeDatetime:
+		open, close = "<v>", "</v>"
+		style = 2
+		if j < len(sw.sheet.columns) && sw.sheet.columns[j].NumberFormat != "" {
+			style = sw.columnStyle(sw.sheet.columns[j])
+		}
+	case CellTypeDate:
+		open, close = "<v>", "</v>"
+		style = sw.ww.styleIndex(Style{NumberFormat: FormatDate})
+		if j < len(sw.sheet.columns) && sw.sheet.columns[j].NumberFormat != "" {
+			style = sw.columnStyle(sw.sheet.columns[j])
+		}
+	case CellTypePercent:
+		t, open, close = ` t="n"`, "<v>", "</v>"
+		style = sw.ww.styleIndex(Style{NumberFormat: "0%"})
+	case CellTypeBool:
+		t, open, close = ` t="b"`, "<v>", "</v>"
+		style = 1
+	case CellTypeFormula:
+		style = 1
+		if _, err := parseDecimal(c.Result); c.Result != "" && err != nil {
+			t = ` t="str"`
+		}
+	default:
+		return b, fmt.Errorf("cell %s%d has the invalid type %d", cellX, cellY, c.Type)
 	}
-	w := bufio.NewWriter(outputfile)
-	err = s.SaveToWriter(w)
-	defer w.Flush()
-	return err
+
+	if c.Style >= firstCustomStyle {
+		n := int(c.Style - firstCustomStyle)
+		if n >= len(sw.sheet.styles) {
+			return b, fmt.Errorf("cell %s%d has style %d, which is not registered with the sheet", cellX, cellY, c.Style)
+		}
+		if err := sw.sheet.styles[n].validate(); err != nil {
+			return b, fmt.Errorf("cell %s%d: %s", cellX, cellY, err.Error())
+		}
+		style = sw.ww.styleIndex(sw.sheet.styles[n])
+	} else if text {
+		style = 5
+	} else if c.Style == StyleGeneral {
+		style = 0
+	} else if c.Style == StyleDefault && c.Type != CellTypePercent {
+		total := cellY == sw.totalRow || uint64(j+1) == sw.totalColumn
+		if dated && total {
+			// totals keep the number format of their dates
+			st := Style{NumberFormat: FormatDateTime, Font: Font{Bold: true}, border: cellY == sw.totalRow}
+			if c.Type == CellTypeDate {
+				st.NumberFormat = FormatDate
+			}
+			if j < len(sw.sheet.columns) && sw.sheet.columns[j].NumberFormat != "" {
+				st.NumberFormat = sw.sheet.columns[j].NumberFormat
+			}
+			style = sw.ww.styleIndex(st)
+		} else if cellY == sw.totalRow {
+			style = 3
+		} else if uint64(j+1) == sw.totalColumn {
+			style = 4
+		}
+	}
+
+	if sw.ww.header.OmitStyles {
+		if dated {
+			return b, fmt.Errorf("datetime cell %s%d can not be written without styles", cellX, cellY)
+		}
+		style = 0
+	}
+
+	b = append(b, `<c r="`...)
+	b = append(b, cellX...)
+	b = strconv.AppendUint(b, cellY, 10)
+	b = append(b, '"')
+	b = append(b, t...)
+	// the default style is omitted
+	if style != 0 {
+		b = append(b, ` s="`...)
+		b = strconv.AppendInt(b, int64(style), 10)
+		b = append(b, '"')
+	}
+	b = append(b, '>')
+	b = append(b, open...)
+	if shared >= 0 {
+		b = strconv.AppendInt(b, int64(shared), 10)
+	} else {
+		b = append(b, c.Value...)
+	}
+	b = append(b, close...)
+	b = append(b, "</c>"...)
+
+	sw.ww.stats.Cells++
+
+	return b, nil
 }
 
-// Save the XLSX file to the given writer
-func (s *Sheet) SaveToWriter(w io.Writer) error {
+// The name of the column with zero-based index j, for example "AA" for 26.
+// The names are cached, as they are needed for every cell.
+func (sw *SheetWriter) colName(j int) string {
+	for len(sw.colNames) <= j {
+		sw.colNames = append(sw.colNames, colName(uint64(len(sw.colNames))))
+	}
+	return sw.colNames[j]
+}
 
-	ww := NewWorkbookWriter(w)
+// Write the total row of the sheet, after all of its other rows, styled as
+// the Sheet's TotalRow would style the last row of a sheet held in memory
+func (sw *SheetWriter) WriteTotalRow(r Row) error {
+	if sw.closed {
+		return ErrSheetClosed
+	}
 
-	sw, err := ww.NewSheetWriter(s)
-	if err != nil {
-		return err
+	if sw.currentIndex == maxRows && sw.ww.SplitSheets {
+		err := sw.splitSheet()
+		if err != nil {
+			return err
+		}
 	}
 
-	err = sw.WriteRows(s.rows)
+	sw.totalRow = sw.currentIndex + 1
+	err := sw.WriteRows([]Row{r})
 	if err != nil {
-		return err
+		sw.totalRow = 0
 	}
 
-	err = ww.Close()
-
 	return err
 }
 
-// Handles the writing of an XLSX workbook
-type WorkbookWriter struct {
-	zipWriter     *zip.Writer
-	sheetWriter   *SheetWriter
-	headerWritten bool
-	closed        bool
+// Write the given rows to this SheetWriter as WriteRows does, stopping with
+// the error of the context if it is cancelled. The rows before the
+// cancellation have been written.
+func (sw *SheetWriter) WriteRowsContext(ctx context.Context, rows []Row) error {
+	for i := range rows {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := sw.WriteRows(rows[i : i+1])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// NewWorkbookWriter creates a new WorkbookWriter, which SheetWriters will
-// operate on. It must be closed when all Sheets have been written.
-func NewWorkbookWriter(w io.Writer) *WorkbookWriter {
-	return &WorkbookWriter{zip.NewWriter(w), nil, false, false}
+// Write column-major data to this SheetWriter. Each element of cols holds the
+// cells of one column, top to bottom, and all columns must have the same
+// length.
+func (sw *SheetWriter) WriteColumns(cols [][]Cell) error {
+	rows, err := ColumnsToRows(cols)
+	if err != nil {
+		return err
+	}
+
+	return sw.WriteRows(rows)
 }
 
-// Write the header files of the workbook
-func (ww *WorkbookWriter) WriteHeader(s *Sheet) error {
-	if ww.closed {
-		panic("Can not write to closed WorkbookWriter")
+// Write a slice of structs to this SheetWriter, one row per struct. Each
+// column of the sheet takes the value of the exported field with the column's
+// name, given by an `xlsx:"Name"` tag or else by the name of the field; fields
+// tagged `xlsx:"-"` are skipped. Cell types follow the kind of the field:
+// integers and floats become numbers, bools become booleans, time.Time
+// becomes a datetime and strings become shared strings. Nil pointers and
+// columns without a field are left empty.
+func (sw *SheetWriter) WriteStructs(rows interface{}) error {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Errorf("expected a slice of structs, got %T", rows)
 	}
 
-	if ww.headerWritten {
-		panic("Workbook header already written")
+	t := v.Type().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("expected a slice of structs, got %T", rows)
+	}
+
+	// field index for each column, or -1 if the column has no field
+	fields := make([]int, len(sw.sheet.columns))
+	for i, c := range sw.sheet.columns {
+		fields[i] = -1
+		for j := 0; j < t.NumField(); j++ {
+			f := t.Field(j)
+			name := f.Tag.Get("xlsx")
+			if name == "" {
+				name = f.Name
+			}
+			if f.PkgPath == "" && name != "-" && name == c.Name {
+				fields[i] = j
+				break
+			}
+		}
 	}
 
-	z := ww.zipWriter
+	out := make([]Row, v.Len())
+	for i := range out {
+		e := v.Index(i)
+		if e.Kind() == reflect.Ptr {
+			e = e.Elem()
+		}
 
-	f, err := z.Create("[Content_Types].xml")
-	err = TemplateContentTypes.Execute(f, nil)
-	if err != nil {
-		return err
+		out[i] = sw.sheet.NewRow()
+		if !e.IsValid() {
+			continue
+		}
+
+		for j, f := range fields {
+			if f < 0 {
+				continue
+			}
+
+			c, err := reflectCell(e.Field(f))
+			if err != nil {
+				return fmt.Errorf("field %s: %s", t.Field(f).Name, err.Error())
+			}
+			out[i].Cells[j] = sw.sheet.sharedCell(c)
+		}
 	}
 
-	f, err = z.Create("docProps/app.xml")
-	err = TemplateApp.Execute(f, s)
-	if err != nil {
-		return err
+	return sw.WriteRows(out)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Create a cell from a reflected value, choosing the cell type from its kind
+func reflectCell(v reflect.Value) (Cell, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return Cell{}, nil
+		}
+		v = v.Elem()
 	}
 
-	f, err = z.Create("docProps/core.xml")
-	err = TemplateCore.Execute(f, s.DocumentInfo)
-	if err != nil {
-		return err
+	if v.Type().ConvertibleTo(timeType) {
+		return NewDateCell(v.Convert(timeType).Interface().(time.Time)), nil
 	}
 
-	f, err = z.Create("_rels/.rels")
-	err = TemplateRelationships.Execute(f, nil)
-	if err != nil {
-		return err
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Cell{Type: CellTypeNumber, Value: strconv.FormatInt(v.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Cell{Type: CellTypeNumber, Value: strconv.FormatUint(v.Uint(), 10)}, nil
+	case reflect.Float32:
+		return Cell{Type: CellTypeNumber, Value: formatFloat(v.Float(), 32)}, nil
+	case reflect.Float64:
+		return NewNumberCell(v.Float()), nil
+	case reflect.Bool:
+		return NewBoolCell(v.Bool()), nil
+	case reflect.String:
+		return NewStringCell(v.String()), nil
 	}
 
-	f, err = z.Create("xl/workbook.xml")
-	err = TemplateWorkbook.Execute(f, s)
-	if err != nil {
-		return err
+	return Cell{}, &UnsupportedTypeError{v.Type()}
+}
+
+// Transpose column-major data into rows. Each element of cols holds the cells
+// of one column, top to bottom, and all columns must have the same length.
+func ColumnsToRows(cols [][]Cell) ([]Row, error) {
+	if len(cols) == 0 {
+		return []Row{}, nil
 	}
 
-	f, err = z.Create("xl/_rels/workbook.xml.rels")
-	err = TemplateWorkbookRelationships.Execute(f, nil)
-	if err != nil {
-		return err
+	n := len(cols[0])
+	for i, c := range cols {
+		if len(c) != n {
+			return nil, fmt.Errorf("column %d has %d cells and %d were expected", i, len(c), n)
+		}
 	}
 
-	f, err = z.Create("xl/styles.xml")
-	err = TemplateStyles.Execute(f, nil)
-	if err != nil {
-		return err
+	rows := make([]Row, n)
+	for i := range rows {
+		rows[i].Cells = make([]Cell, len(cols))
+		for j, c := range cols {
+			rows[i].Cells[j] = c[i]
+		}
 	}
 
-	f, err = z.Create("xl/sharedStrings.xml")
-	err = TemplateStringLookups.Execute(f, s.SharedStrings())
-	if err != nil {
-		return err
+	return rows, nil
+}
+
+// The content of a formula cell: the formula, without any leading "=", and
+// its cached result
+func formulaContent(c Cell) string {
+	f := "<f>" + html.EscapeString(strings.TrimPrefix(c.Value, "=")) + "</f>"
+	if c.Result != "" {
+		f += "<v>" + html.EscapeString(c.Result) + "</v>"
 	}
+	return f
+}
 
-	return nil
+// Map a reference to the sheet's shared string table to the index of the
+// string in the workbook's table
+func (sw *SheetWriter) sharedStringIndex(v string) (int, error) {
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 || i >= len(sw.sheet.sharedStrings) {
+		return 0, fmt.Errorf("invalid shared string reference %q", v)
+	}
+
+	return sw.ww.sharedString(sw.sheet.sharedStrings[i]), nil
 }
 
-// Closes the WorkbookWriter
-func (ww *WorkbookWriter) Close() error {
-	if ww.closed {
-		panic("WorkbookWriter already closed")
+// The cellXfs index applied to the cells of a column by default
+func (sw *SheetWriter) columnStyle(c Column) int {
+	if c.Text {
+		return 5
+	}
+	if c.NumberFormat != "" {
+		return sw.ww.styleIndex(Style{NumberFormat: c.NumberFormat})
+	}
+	if c.Type == CellTypeDatetime {
+		return 2
+	}
+	if c.Type == CellTypeDate {
+		return sw.ww.styleIndex(Style{NumberFormat: FormatDate})
+	}
+	return 1
+}
+
+// Widest column allowed by Excel, in characters
+const maxColumnWidth = 255
+
+// Widen column j to fit the cell, if necessary
+func (sw *SheetWriter) fitWidth(j int, c Cell) {
+	v := c.Value
+	switch c.Type {
+	case CellTypeString:
+		i, err := strconv.Atoi(c.Value)
+		if c.shared && err == nil && i >= 0 && i < len(sw.sheet.sharedStrings) {
+			v = html.UnescapeString(sw.sheet.sharedStrings[i])
+		}
+	case CellTypeDatetime:
+		v = "yyyy-mm-dd hh:mm"
+	case CellTypeDate:
+		v = "yyyy-mm-dd"
+	case CellTypeBool:
+		v = "FALSE"
+	case CellTypeFormula:
+		v = c.Result
 	}
 
-	if ww.sheetWriter != nil {
-		err := ww.sheetWriter.Close()
-		if err != nil {
-			return err
+	var n uint64
+	for _, line := range strings.Split(v, "\n") {
+		if l := uint64(utf8.RuneCountInString(line)); l > n {
+			n = l
 		}
 	}
 
-	ww.closed = true
+	// allow for the padding Excel adds to the widest content
+	n += 2
+	if n > maxColumnWidth {
+		n = maxColumnWidth
+	}
 
-	return ww.zipWriter.Close()
+	for len(sw.widths) <= j {
+		sw.widths = append(sw.widths, 0)
+	}
+	if n > sw.widths[j] {
+		sw.widths[j] = n
+	}
 }
 
-// NewSheetWriter creates a new SheetWriter in this workbook using the given sheet.
-// It returns a SheetWriter to which rows can be written.
-// All rows must be written to the SheetWriter before the next call to NewSheetWriter,
-// as this will automatically close the previous SheetWriter.
-func (ww *WorkbookWriter) NewSheetWriter(s *Sheet) (*SheetWriter, error) {
-	if ww.closed {
-		panic("Can not write to closed WorkbookWriter")
+// Frozen pane of the sheet template
+type paneData struct {
+	XSplit      uint64
+	YSplit      uint64
+	TopLeftCell string
+	ActivePane  string
+}
+
+var viewCellPattern = regexp.MustCompile(`^[A-Za-z]{1,3}[1-9][0-9]*$`)
+
+// The ActiveCell or TopLeftCell of a sheet in upper case, or an error if it
+// is not the reference of a single cell such as "B5"
+func viewCell(field, ref string) (string, error) {
+	if ref == "" {
+		return "", nil
 	}
+	if !viewCellPattern.MatchString(ref) {
+		return "", fmt.Errorf("invalid %s %q", field, ref)
+	}
+	return strings.ToUpper(ref), nil
+}
 
-	if !ww.headerWritten {
-		err := ww.WriteHeader(s)
-		if err != nil {
-			return nil, err
-		}
+// The frozen pane of the sheet, or nil when no rows or columns are frozen.
+// A TopLeftCell within the frozen rows or columns is an error, as it must be
+// the top left cell of the scrolling pane.
+func frozenPane(s *Sheet) (*paneData, error) {
+	if s.FreezeRows == 0 && s.FreezeCols == 0 {
+		return nil, nil
+	}
+
+	topLeft, err := viewCell("top left cell", s.TopLeftCell)
+	if err != nil {
+		return nil, err
 	}
 
-	f, err := ww.zipWriter.Create("xl/worksheets/" + "sheet1" + ".xml")
-	sw := &SheetWriter{f, err, 0, 0, false}
+	p := &paneData{XSplit: s.FreezeCols, YSplit: s.FreezeRows, TopLeftCell: topLeft}
 
-	if ww.sheetWriter != nil {
-		err = ww.sheetWriter.Close()
+	if p.TopLeftCell == "" {
+		x, y := CellIndex(s.FreezeCols, s.FreezeRows)
+		p.TopLeftCell = fmt.Sprintf("%s%d", x, y)
+	} else {
+		x, y, err := parseCellRef(p.TopLeftCell)
 		if err != nil {
 			return nil, err
 		}
+		if x < s.FreezeCols || y < s.FreezeRows {
+			return nil, fmt.Errorf("top left cell %s is within the frozen rows and columns", p.TopLeftCell)
+		}
 	}
 
-	ww.sheetWriter = sw
-	err = sw.WriteHeader(s)
+	switch {
+	case s.FreezeRows > 0 && s.FreezeCols > 0:
+		p.ActivePane = "bottomRight"
+	case s.FreezeRows > 0:
+		p.ActivePane = "bottomLeft"
+	default:
+		p.ActivePane = "topRight"
+	}
 
-	return sw, err
+	return p, nil
 }
 
-// Handles the writing of a sheet
-type SheetWriter struct {
-	f            io.Writer
-	err          error
-	currentIndex uint64
-	maxNCols     uint64
-	closed       bool
+// A column of the sheet template, with the cellXfs index of its cells
+type columnData struct {
+	Column
+	Style int
 }
 
-// Write the given rows to this SheetWriter
-func (sw *SheetWriter) WriteRows(rows []Row) error {
+// Closes the SheetWriter
+func (sw *SheetWriter) Close() error {
 	if sw.closed {
-		panic("Can not write to closed SheetWriter")
+		return ErrSheetClosed
 	}
 
+	sw.closed = true
+
 	var err error
+	if sw.spool != nil {
+		err = sw.closeSpool()
+	} else {
+		err = sw.writeSheetEnd(sw.f)
+	}
+	if err != nil {
+		return err
+	}
 
-	for i, r := range rows {
-		rb := &bytes.Buffer{}
+	return sw.writeImages()
+}
 
-		if sw.maxNCols < uint64(len(r.Cells)) {
-			sw.maxNCols = uint64(len(r.Cells))
-		}
+// Copy the rows written to the temporary file into the workbook, preceded by
+// the sheet header with the now known dimension
+func (sw *SheetWriter) closeSpool() error {
+	defer os.Remove(sw.spool.Name())
+	defer sw.spool.Close()
 
-		for j, c := range r.Cells {
+	err := sw.spoolWriter.Flush()
+	if err != nil {
+		return err
+	}
 
-			cellX, cellY := CellIndex(uint64(j), uint64(i)+sw.currentIndex)
+	_, err = sw.spool.Seek(0, 0)
+	if err != nil {
+		return err
+	}
 
-			if c.Type == CellTypeDatetime {
-				d, err := time.Parse(time.RFC3339, c.Value)
-				if err == nil {
-					c.Value = OADate(d)
-				}
-			} else if c.Type == CellTypeInlineString {
-				c.Value = html.EscapeString(c.Value)
-			}
+	f, err := sw.ww.createPart(sw.partName)
+	if err != nil {
+		return err
+	}
 
-			var cellString string
-
-			switch c.Type {
-			case CellTypeString:
-				cellString = `<c r="%s%d" t="s" s="1"><v>%s</v></c>`
-			case CellTypeInlineString:
-				cellString = `<c r="%s%d" t="inlineStr"><is><t>%s</t></is></c>`
-			case CellTypeNumber:
-				cellString = `<c r="%s%d" t="n" s="1"><v>%s</v></c>`
-			case CellTypeDatetime:
-				cellString = `<c r="%s%d" s="2"><v>%s</v></c>`
-			}
+	// the dimension covers the declared columns even if every row is shorter
+	ncols := sw.maxNCols
+	if n := uint64(len(sw.sheet.columns)); n > ncols {
+		ncols = n
+	}
+
+	err = sw.writeSheetStart(f, sw.sheet, dimensionRef(ncols, sw.currentIndex))
+	if err != nil {
+		return err
+	}
 
-			io.WriteString(rb, fmt.Sprintf(cellString, cellX, cellY, c.Value))
+	_, err = io.Copy(f, sw.spool)
+	if err != nil {
+		return err
+	}
 
-			if err != nil {
-				return err
-			}
-		}
+	return sw.writeSheetEnd(f)
+}
+
+// Range of merged cells, between zero-based columns x1 and x2 and rows y1 and
+// y2 inclusive
+type mergeRange struct {
+	x1, y1, x2, y2 uint64
+}
+
+// The reference of the range, for example "A1:B3"
+func (m mergeRange) String() string {
+	x1, y1 := CellIndex(m.x1, m.y1)
+	x2, y2 := CellIndex(m.x2, m.y2)
+	return fmt.Sprintf("%s%d:%s%d", x1, y1, x2, y2)
+}
+
+// Report whether the ranges have any cell in common
+func (m mergeRange) overlaps(o mergeRange) bool {
+	return m.x1 <= o.x2 && o.x1 <= m.x2 && m.y1 <= o.y2 && o.y1 <= m.y2
+}
+
+// The reference of the range of cells from A1 covering the given number of
+// columns and rows. An empty sheet has the dimension "A1".
+func dimensionRef(ncols, nrows uint64) string {
+	if ncols == 0 || nrows == 0 {
+		return "A1"
+	}
+
+	cellEndX, cellEndY := CellIndex(ncols-1, nrows-1)
+	return fmt.Sprintf("A1:%s%d", cellEndX, cellEndY)
+}
+
+// Write the end of the sheet XML, including the elements which follow the
+// rows such as merged cells
+func (sw *SheetWriter) writeSheetEnd(w io.Writer) error {
+	merges := make([]string, len(sw.mergeCells))
+	for i, m := range sw.mergeCells {
+		merges[i] = m.String()
+	}
 
-		rowString := fmt.Sprintf(`<row r="%d">%s</row>`, uint64(i)+sw.currentIndex+1, rb.String())
+	filter := ""
+	if sw.sheet.AutoFilter != "" {
+		if !rangePattern.MatchString(sw.sheet.AutoFilter) {
+			return fmt.Errorf("invalid autofilter range %q", sw.sheet.AutoFilter)
+		}
+		filter = strings.ToUpper(sw.sheet.AutoFilter)
+	} else if sw.sheet.filterRows && sw.currentIndex > 0 {
+		filter = dimensionRef(sw.maxNCols, sw.currentIndex)
+	}
 
-		_, err = io.WriteString(sw.f, rowString)
+	validations := make([]validationData, len(sw.sheet.dataValidations))
+	for i, v := range sw.sheet.dataValidations {
+		d, err := v.data()
 		if err != nil {
 			return err
 		}
+		validations[i] = d
+	}
 
+	conditions := make([]conditionData, len(sw.sheet.conditionalFormats))
+	for i, f := range sw.sheet.conditionalFormats {
+		d, err := f.data()
+		if err != nil {
+			return err
+		}
+		d.Priority = i + 1
+		if f.Type == ConditionCellIs {
+			d.DxfID = sw.ww.dxfIndex(f.Style)
+		}
+		conditions[i] = d
 	}
 
-	sw.currentIndex += uint64(len(rows))
+	sheet := struct {
+		*Sheet
+		FilterRange        string
+		MergeCells         []string
+		ConditionalFormats []conditionData
+		DataValidations    []validationData
+		Drawing            bool
+	}{
+		Sheet:              sw.sheet,
+		FilterRange:        filter,
+		MergeCells:         merges,
+		ConditionalFormats: conditions,
+		DataValidations:    validations,
+		Drawing:            len(sw.sheet.images) > 0,
+	}
 
-	return nil
+	return TemplateSheetEnd.Execute(w, sheet)
 }
 
-// Closes the SheetWriter
-func (sw *SheetWriter) Close() error {
+// Writes the header of a sheet
+func (sw *SheetWriter) WriteHeader(s *Sheet) error {
 	if sw.closed {
-		panic("SheetWriter already closed")
+		return ErrSheetClosed
 	}
 
-	cellEndX, cellEndY := CellIndex(sw.maxNCols-1, sw.currentIndex-1)
-	sheetEnd := fmt.Sprintf(`<dimension ref="A1:%s%d"/>`, cellEndX, cellEndY)
-	sheetEnd += `</sheetData></worksheet>`
-	_, err := io.WriteString(sw.f, sheetEnd)
+	return sw.writeSheetStart(sw.f, s, "")
+}
 
-	sw.closed = true
+// Write the start of the sheet XML, including the dimension when it is known
+func (sw *SheetWriter) writeSheetStart(w io.Writer, s *Sheet, dimension string) error {
+	var outlineLevelCol uint
+	cols := make([]columnData, len(s.columns))
+	for i, c := range s.columns {
+		if c.OutlineLevel > maxOutlineLevel {
+			return fmt.Errorf("column %q has outline level %d and at most %d is allowed", c.Name, c.OutlineLevel, maxOutlineLevel)
+		}
+		if c.OutlineLevel > outlineLevelCol {
+			outlineLevelCol = c.OutlineLevel
+		}
+		if i < len(sw.widths) && sw.widths[i] > 0 {
+			c.Width = sw.widths[i]
+		}
+		cols[i] = columnData{c, sw.columnStyle(c)}
+	}
 
-	return err
-}
+	if s.DefaultColWidth < 0 || s.DefaultRowHeight < 0 {
+		return fmt.Errorf("invalid default column width %v or row height %v", s.DefaultColWidth, s.DefaultRowHeight)
+	}
 
-// Writes the header of a sheet
-func (sw *SheetWriter) WriteHeader(s *Sheet) error {
-	if sw.closed {
-		panic("Can not write to closed SheetWriter")
+	tabColor := ""
+	if s.TabColor != "" {
+		if !colorPattern.MatchString(s.TabColor) {
+			return fmt.Errorf("invalid tab colour %q", s.TabColor)
+		}
+		tabColor = argb(s.TabColor)
+	}
+
+	// the outline level of streamed rows is only known when the rows are
+	// spooled
+	outlineLevel := sw.outlineLevel
+	for _, r := range s.rows {
+		if r.OutlineLevel > outlineLevel {
+			outlineLevel = r.OutlineLevel
+		}
+	}
+
+	activeCell, err := viewCell("active cell", s.ActiveCell)
+	if err != nil {
+		return err
+	}
+	topLeft, err := viewCell("top left cell", s.TopLeftCell)
+	if err != nil {
+		return err
+	}
+	pane, err := frozenPane(s)
+	if err != nil {
+		return err
 	}
 
 	sheet := struct {
-		Cols []Column
+		*Sheet
+		OmitStyles      bool
+		TopLeftCell     string
+		Cols            []columnData
+		Dimension       string
+		Pane            *paneData
+		Selection       string
+		TabRGB          string
+		OutlineLevelRow uint
+		OutlineLevelCol uint
 	}{
-		Cols: s.columns,
+		Sheet:           s,
+		OmitStyles:      sw.ww.header.OmitStyles,
+		TopLeftCell:     topLeft,
+		Cols:            cols,
+		Dimension:       dimension,
+		Pane:            pane,
+		Selection:       activeCell,
+		TabRGB:          tabColor,
+		OutlineLevelRow: outlineLevel,
+		OutlineLevelCol: outlineLevelCol,
+	}
+
+	if sheet.Pane != nil && sheet.Selection == "" {
+		sheet.Selection = sheet.Pane.TopLeftCell
 	}
 
-	return TemplateSheetStart.Execute(sw.f, sheet)
+	return TemplateSheetStart.Execute(w, sheet)
 }
@@ -1,13 +1,70 @@
 package xlsx
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/xml"
 	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+// Save the sheet and return the content of the named part of the XLSX file
+func savedPart(t *testing.T, s *Sheet, name string) string {
+	var b bytes.Buffer
+
+	err := s.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+	content, ok := parts[name]
+	if !ok {
+		t.Fatalf("part %s not found in output", name)
+	}
+
+	return content
+}
+
+// Read the content of every part of an XLSX file
+func readParts(t *testing.T, b []byte) map[string]string {
+	z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("output is not a valid zip file: %s", err.Error())
+	}
+
+	parts := make(map[string]string)
+
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %s", f.Name, err.Error())
+		}
+		content, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", f.Name, err.Error())
+		}
+		parts[f.Name] = string(content)
+	}
+
+	return parts
+}
+
 type CellIndexTestCase struct {
 	x        uint64
 	y        uint64
@@ -32,6 +89,145 @@ func TestCellIndex(t *testing.T) {
 	}
 }
 
+func TestLocaleIndependentNumbers(t *testing.T) {
+	for _, v := range []string{"LANG", "LC_ALL", "LC_NUMERIC"} {
+		t.Setenv(v, "de_DE.UTF-8")
+	}
+
+	c := TypedCell(1234567.25)
+	if c.Value != "1234567.25" {
+		t.Errorf("expected 1234567.25, got %s", c.Value)
+	}
+
+	d := OADate(time.Date(1970, 1, 1, 12, 20, 0, 0, time.UTC))
+	if d != "25569.513889" {
+		t.Errorf("expected 25569.513889, got %s", d)
+	}
+}
+
+func TestNewNumberCell(t *testing.T) {
+
+	tests := map[string]Cell{
+		"0.1":                   NewNumberCell(0.1),
+		"0.3":                   NewNumberCell(0.3),
+		"100000000000000000000": NewNumberCell(1e20),
+		"1e+21":                 NewNumberCell(1e21),
+		"1000":                  NewNumberCell(1000),
+		"0.33":                  NewNumberCellWithPrecision(1.0/3, 2),
+		"2":                     NewNumberCellWithPrecision(1.5, 0),
+	}
+
+	for expected, c := range tests {
+		if c.Type != CellTypeNumber || c.Value != expected {
+			t.Errorf("expected number %s, got %v", expected, c)
+		}
+	}
+}
+
+func TestSetFloat(t *testing.T) {
+	c := Cell{Type: CellTypeString, Value: "0", Style: StyleGeneral}
+	a, b := 0.1, 0.2
+
+	c.SetFloat(a+b, -1)
+	if c.Type != CellTypeNumber || c.Value != "0.30000000000000004" || c.Style != StyleGeneral {
+		t.Errorf("expected full precision number 0.30000000000000004, got %v", c)
+	}
+
+	c.SetFloat(a+b, 2)
+	if c.Value != "0.30" {
+		t.Errorf("expected 0.30, got %s", c.Value)
+	}
+}
+
+func TestScientificFormat(t *testing.T) {
+	tests := []struct {
+		v        float64
+		expected string
+	}{
+		{6.02214076e23, "6.02214076e+23"},
+		{-1.602176634e-19, "-1.602176634e-19"},
+		{1e21, "1e+21"},
+		{123456789012, "123456789012"},
+		{0.000001, "0.000001"},
+		{0, "0"},
+	}
+
+	for _, c := range tests {
+		cell := NewNumberCell(c.v)
+		if cell.Value != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, cell.Value)
+		}
+		f, err := strconv.ParseFloat(cell.Value, 64)
+		if err != nil || f != c.v {
+			t.Errorf("expected %s to read back as %v", cell.Value, c.v)
+		}
+	}
+
+	sh := NewSheetWithColumns([]Column{Column{Name: "Mass", Width: 10, NumberFormat: FormatScientific}})
+	sh.AppendRow(Row{Cells: []Cell{NewNumberCell(1.67262192e-27)}})
+
+	var b bytes.Buffer
+	err := sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+	parts := readParts(t, b.Bytes())
+
+	for name, expected := range map[string]string{
+		"xl/styles.xml":            `<xf numFmtId="11" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/></cellXfs>`,
+		"xl/worksheets/sheet1.xml": `<c r="A1" t="n" s="6"><v>1.67262192e-27</v></c>`,
+	} {
+		if !strings.Contains(parts[name], expected) {
+			t.Errorf("expected %s in %s: %s", expected, name, parts[name])
+		}
+	}
+
+	for _, v := range []string{"NaN", "Inf", "-Inf"} {
+		if validateCell(Cell{Type: CellTypeNumber, Value: v}) == nil {
+			t.Errorf("expected an error for the number %s", v)
+		}
+	}
+}
+
+func TestCellConstructors(t *testing.T) {
+
+	tests := []TypedCellTestCase{
+		TypedCellTestCase{NewIntCell(-42), CellTypeNumber, "-42"},
+		TypedCellTestCase{NewStringCell("a & b"), CellTypeString, "a & b"},
+		TypedCellTestCase{NewBoolCell(true), CellTypeBool, "1"},
+		TypedCellTestCase{NewBoolCell(false), CellTypeBool, "0"},
+		TypedCellTestCase{NewDateCell(time.Date(2014, 3, 7, 13, 30, 0, 0, time.UTC)), CellTypeDatetime, "2014-03-07T13:30:00Z"},
+	}
+
+	for _, c := range tests {
+		cell := c.value.(Cell)
+		if cell.Type != c.expectedType || cell.Value != c.expected {
+			t.Errorf("expected type %d and value %s, got %v", c.expectedType, c.expected, cell)
+		}
+	}
+}
+
+func TestQuoteSheetRef(t *testing.T) {
+
+	tests := map[string]string{
+		"Data":       "Data!A1",
+		"Data_2.old": "Data_2.old!A1",
+		"My Sheet":   "'My Sheet'!A1",
+		"Bob's":      "'Bob''s'!A1",
+		"2014":       "'2014'!A1",
+		"AB12":       "'AB12'!A1",
+		"R1C1":       "'R1C1'!A1",
+		"Sales-Q1":   "'Sales-Q1'!A1",
+	}
+
+	for name, expected := range tests {
+		s := QuoteSheetRef(name, "A1")
+		if s != expected {
+			t.Errorf("expected %s, got %s", expected, s)
+		}
+	}
+}
+
 type OADateTestCase struct {
 	datetime time.Time
 	expected string
@@ -43,6 +239,10 @@ func TestOADate(t *testing.T) {
 		OADateTestCase{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), "25569"},
 		OADateTestCase{time.Date(1970, 1, 1, 12, 20, 0, 0, time.UTC), "25569.513889"},
 		OADateTestCase{time.Date(2014, 12, 20, 0, 0, 0, 0, time.UTC), "41993"},
+		OADateTestCase{time.Date(1899, 12, 29, 6, 0, 0, 0, time.UTC), "-1.250000"},
+		OADateTestCase{time.Date(1899, 12, 29, 18, 0, 0, 0, time.UTC), "-1.750000"},
+		OADateTestCase{time.Date(1850, 1, 1, 0, 0, 0, 0, time.UTC), "-18260"},
+		OADateTestCase{time.Date(1850, 1, 1, 12, 0, 0, 0, time.UTC), "-18260.500000"},
 	}
 
 	for _, d := range tests {
@@ -50,75 +250,4066 @@ func TestOADate(t *testing.T) {
 		if s != d.expected {
 			t.Errorf("expected %s, got %s", d.expected, s)
 		}
+
+		v, _ := strconv.ParseFloat(s, 64)
+		if r := FromOADate(v); !r.Equal(d.datetime) {
+			t.Errorf("expected %s from FromOADate(%s), got %s", d.datetime, s, r)
+		}
+	}
+
+	// dates more than 292 years from the epoch, beyond a time.Duration
+	far := []OADateTestCase{
+		OADateTestCase{time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC), "2958465"},
+		OADateTestCase{time.Date(9999, 12, 31, 18, 0, 0, 0, time.UTC), "2958465.750000"},
+		OADateTestCase{time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC), "146099"},
+		OADateTestCase{time.Date(1500, 1, 1, 0, 0, 0, 0, time.UTC), "-146095"},
+	}
+
+	for _, d := range far {
+		s := OADate(d.datetime)
+		if s != d.expected {
+			t.Errorf("expected %s for %s, got %s", d.expected, d.datetime, s)
+		}
+
+		v, _ := strconv.ParseFloat(s, 64)
+		if r := FromOADate(v); !r.Equal(d.datetime) {
+			t.Errorf("expected %s from FromOADate(%s), got %s", d.datetime, s, r)
+		}
 	}
 }
 
-func TestTemplates(t *testing.T) {
+func TestOADateTimeZones(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	newYork := time.FixedZone("EST", -5*60*60)
 
-	var b bytes.Buffer
-	var err error
-	var s Sheet
+	tests := []OADateTestCase{
+		OADateTestCase{time.Date(2020, 1, 1, 0, 0, 0, 0, tokyo), "43831"},
+		OADateTestCase{time.Date(2020, 1, 1, 6, 0, 0, 0, tokyo), "43831.250000"},
+		OADateTestCase{time.Date(2019, 12, 31, 23, 30, 0, 0, newYork), "43830.979167"},
+		OADateTestCase{time.Date(2020, 1, 1, 0, 0, 0, 0, tokyo).In(time.UTC), "43830.625000"},
+	}
 
-	err = TemplateContentTypes.Execute(&b, nil)
-	if err != nil {
-		t.Errorf("template TemplateContentTypes failed to Execute returning error %s", err.Error())
+	for _, d := range tests {
+		s := OADate(d.datetime)
+		if s != d.expected {
+			t.Errorf("expected %s for %s, got %s", d.expected, d.datetime, s)
+		}
 	}
 
-	err = TemplateRelationships.Execute(&b, nil)
-	if err != nil {
-		t.Errorf("template TemplateRelationships failed to Execute returning error %s", err.Error())
+	sh := NewSheetWithColumns([]Column{Column{Name: "Date", Width: 10}})
+	sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeDatetime, Value: "2020-01-01T00:00:00+09:00"}}})
+	sh.AppendRow(Row{Cells: []Cell{NewDateCell(time.Date(2020, 1, 1, 0, 0, 0, 0, newYork))}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<c r="A1" s="2"><v>43831</v></c></row><row r="2"><c r="A2" s="2"><v>43831</v></c>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
 	}
+}
 
-	err = TemplateApp.Execute(&b, nil)
-	if err != nil {
-		t.Errorf("template TemplateApp failed to Execute returning error %s", err.Error())
+func TestDateCellTime(t *testing.T) {
+	d := time.Date(2014, 3, 7, 12, 0, 0, 0, time.UTC)
+
+	sh := NewSheetWithColumns([]Column{Column{Name: "Date", Width: 10}})
+	sh.Date1904 = true
+	sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeDatetime, Time: d}}})
+	sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeDatetime, Value: "not a date", Time: d}}})
+
+	if errs := sh.Validate(); len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
 	}
 
-	err = TemplateCore.Execute(&b, s.DocumentInfo)
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<c r="A1" s="2"><v>40243.500000</v></c></row><row r="2"><c r="A2" s="2"><v>40243.500000</v></c>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	c := NewDateCell(d)
+	if !c.Time.Equal(d) {
+		t.Errorf("expected NewDateCell to set the Time %s, got %s", d, c.Time)
+	}
+}
+
+func TestDateCell(t *testing.T) {
+	d := time.Date(2014, 3, 7, 0, 0, 0, 0, time.UTC)
+
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Date", Width: 10, Type: CellTypeDate},
+		Column{Name: "Created", Width: 10},
+	})
+	sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeDate, Time: d}, NewDateCell(d.Add(90 * time.Minute))}})
+
+	var b bytes.Buffer
+	err := sh.SaveToWriter(&b)
 	if err != nil {
-		t.Errorf("template TemplateCore failed to Execute returning error %s", err.Error())
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+	parts := readParts(t, b.Bytes())
+
+	for name, expected := range map[string]string{
+		"xl/styles.xml":            `<numFmts count="3">`,
+		"xl/worksheets/sheet1.xml": `<c r="A1" s="6"><v>41705</v></c><c r="B1" s="2"><v>41705.062500</v></c>`,
+	} {
+		if !strings.Contains(parts[name], expected) {
+			t.Errorf("expected %s in %s: %s", expected, name, parts[name])
+		}
+	}
+
+	expected := `<col min="1" max="1" width="10" customWidth="1" style="6"/>`
+	if !strings.Contains(parts["xl/worksheets/sheet1.xml"], expected) {
+		t.Errorf("expected %s in %s", expected, parts["xl/worksheets/sheet1.xml"])
+	}
+	expected = `<xf numFmtId="165" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/></cellXfs>`
+	if !strings.Contains(parts["xl/styles.xml"], expected) {
+		t.Errorf("expected %s in %s", expected, parts["xl/styles.xml"])
 	}
 
-	err = TemplateWorkbook.Execute(&b, nil)
+	r, err := ReadSheet(bytes.NewReader(b.Bytes()))
 	if err != nil {
-		t.Errorf("template TemplateWorkbook failed to Execute returning error %s", err.Error())
+		t.Fatalf("ReadSheet returned error %s", err.Error())
+	}
+	for i, expected := range []CellType{CellTypeDate, CellTypeDatetime} {
+		if c := r.rows[0].Cells[i]; c.Type != expected {
+			t.Errorf("expected type %d for cell %d read back, got %d", expected, i, c.Type)
+		}
+	}
+}
+
+type TypedCellTestCase struct {
+	value        interface{}
+	expectedType CellType
+	expected     string
+}
+
+func TestTypedCell(t *testing.T) {
+
+	tests := []TypedCellTestCase{
+		TypedCellTestCase{10, CellTypeNumber, "10"},
+		TypedCellTestCase{int64(-3), CellTypeNumber, "-3"},
+		TypedCellTestCase{uint8(255), CellTypeNumber, "255"},
+		TypedCellTestCase{0.1, CellTypeNumber, "0.1"},
+		TypedCellTestCase{true, CellTypeBool, "1"},
+		TypedCellTestCase{false, CellTypeBool, "0"},
+		TypedCellTestCase{"Apple", CellTypeString, "Apple"},
+		TypedCellTestCase{time.Date(1980, 4, 24, 0, 0, 0, 0, time.UTC), CellTypeDatetime, "1980-04-24T00:00:00Z"},
+		TypedCellTestCase{[]int{1, 2}, CellTypeString, "[1 2]"},
+	}
+
+	for _, c := range tests {
+		cell := TypedCell(c.value)
+		if cell.Type != c.expectedType || cell.Value != c.expected {
+			t.Errorf("expected (%d, %s), got (%d, %s)", c.expectedType, c.expected, cell.Type, cell.Value)
+		}
+	}
+
+	_, err := TypedCellStrict([]int{1, 2})
+	if _, ok := err.(*UnsupportedTypeError); !ok {
+		t.Errorf("expected *UnsupportedTypeError, got %v", err)
+	}
+}
+
+func TestOutlineSummary(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	if strings.Contains(x, "<sheetPr>") {
+		t.Errorf("expected no sheetPr by default, got %s", x)
+	}
+
+	sh.OutlineSummaryAbove = true
+	sh.OutlineSummaryLeft = true
+
+	x = savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<sheetPr><outlinePr summaryBelow="0" summaryRight="0"/></sheetPr>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
 	}
+}
+
+func TestActiveCell(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	if strings.Contains(x, "<selection") {
+		t.Errorf("expected no selection by default, got %s", x)
+	}
+
+	sh.ActiveCell = "A2"
+
+	x = savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<sheetView workbookViewId="0"><selection activeCell="A2" sqref="A2"/></sheetView>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
 
-	err = TemplateWorkbookRelationships.Execute(&b, nil)
+func TestSharedStringCount(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	for _, v := range []string{"Apple", "Pear", "Apple"} {
+		r := sh.NewRow()
+		r.Cells[0] = Cell{Type: CellTypeString, Value: v}
+		sh.AppendRow(r)
+	}
+
+	x := savedPart(t, &sh, "xl/sharedStrings.xml")
+	expected := `count="3" uniqueCount="2"`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	// references from every sheet are counted, and strings used by several
+	// sheets are unique once
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	for i := 0; i < 2; i++ {
+		sw, err := ww.NewSheetWriter(&sh)
+		if err != nil {
+			t.Fatalf("NewSheetWriter returned error %s", err.Error())
+		}
+		err = sw.WriteRows(sh.rows)
+		if err != nil {
+			t.Fatalf("WriteRows returned error %s", err.Error())
+		}
+	}
+	err := ww.Close()
 	if err != nil {
-		t.Errorf("template TemplateWorkbookRelationships failed to Execute returning error %s", err.Error())
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	x = readParts(t, b.Bytes())["xl/sharedStrings.xml"]
+	expected = `count="6" uniqueCount="2"`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestTabColor(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	sh.TabColor = "00b050"
+	sh.OutlineSummaryAbove = true
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<sheetPr><tabColor rgb="FF00B050"/><outlinePr summaryBelow="0"/></sheetPr>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	sh.TabColor = "green"
+	err := sh.SaveToWriter(ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected an error for the tab colour green")
+	}
+}
+
+func TestRowOutlineLevel(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Amount", Width: 10}})
+	sh.AppendRow(Row{Cells: []Cell{NewIntCell(1)}, OutlineLevel: 2})
+	sh.AppendRow(Row{Cells: []Cell{NewIntCell(2)}, OutlineLevel: 1})
+	sh.AppendRow(Row{Cells: []Cell{NewIntCell(3)}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	for _, expected := range []string{
+		`<sheetFormatPr defaultRowHeight="15" outlineLevelRow="2" x14ac:dyDescent="0.25"/>`,
+		`<row r="1" outlineLevel="2">`,
+		`<row r="2" outlineLevel="1">`,
+		`<row r="3">`,
+	} {
+		if !strings.Contains(x, expected) {
+			t.Errorf("expected %s in %s", expected, x)
+		}
+	}
+
+	sh = NewSheetWithColumns([]Column{Column{Name: "Amount", Width: 10}})
+	sh.AppendRow(Row{Cells: []Cell{NewIntCell(1)}, OutlineLevel: 8})
+	err := sh.SaveToWriter(ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected an error for outline level 8")
+	}
+}
+
+func TestColumnOutlineLevel(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Total", Width: 10},
+		Column{Name: "Q1", Width: 10, OutlineLevel: 1},
+		Column{Name: "Q2", Width: 10, OutlineLevel: 1},
+	})
+	sh.OutlineSummaryLeft = true
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	for _, expected := range []string{
+		`<sheetPr><outlinePr summaryRight="0"/></sheetPr>`,
+		`<sheetFormatPr defaultRowHeight="15" outlineLevelCol="1" x14ac:dyDescent="0.25"/>`,
+		`<col min="1" max="1" width="10" customWidth="1" style="1"/><col min="2" max="2" width="10" customWidth="1" style="1" outlineLevel="1"/>`,
+	} {
+		if !strings.Contains(x, expected) {
+			t.Errorf("expected %s in %s", expected, x)
+		}
+	}
+
+	sh = NewSheetWithColumns([]Column{Column{Name: "Total", Width: 10, OutlineLevel: 8}})
+	err := sh.SaveToWriter(ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected an error for outline level 8")
+	}
+}
+
+func TestRightToLeft(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	sh.RightToLeft = true
+	sh.HideGridLines = true
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<sheetView showGridLines="0" rightToLeft="1" workbookViewId="0">`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestHideGridLines(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	sh.HideGridLines = true
+	sh.ActiveCell = "A2"
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<sheetView showGridLines="0" workbookViewId="0"><selection activeCell="A2" sqref="A2"/></sheetView>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
 	}
+}
+
+func TestTopLeftCell(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	sh.TopLeftCell = "A100"
+	sh.ActiveCell = "A100"
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<sheetView workbookViewId="0" topLeftCell="A100"><selection activeCell="A100" sqref="A100"/></sheetView>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestCellValues(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10},
+	})
+
+	d := time.Date(1980, 4, 24, 0, 0, 0, 0, time.UTC)
+	values := []interface{}{"Apple & Pear", 2.5, true, d}
+
+	for i, v := range values {
+		err := sh.SetCellValue(1, i+1, v)
+		if err != nil {
+			t.Fatalf("SetCellValue returned error %s", err.Error())
+		}
+	}
+
+	for i, v := range values {
+		got, err := sh.GetCellValue(1, i+1)
+		if err != nil {
+			t.Fatalf("GetCellValue returned error %s", err.Error())
+		}
+		if got != v {
+			t.Errorf("expected %v, got %v", v, got)
+		}
+	}
+
+	got, err := sh.GetCellValue(0, 0)
+	if err != nil || got != nil {
+		t.Errorf("expected nil for an unset cell, got %v, %v", got, err)
+	}
+
+	_, err = sh.GetCellValue(2, 0)
+	if err == nil {
+		t.Errorf("expected an error for a cell outside the sheet")
+	}
+
+	err = sh.SetCellValue(2, 0, 1)
+	if err == nil {
+		t.Errorf("expected an error setting a cell outside the sheet")
+	}
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	if !strings.Contains(x, `<row r="1"></row><row r="2"><c r="B2" t="s" s="1"><v>0</v></c></row>`) {
+		t.Errorf("expected unset cells to be left empty, got %s", x)
+	}
+}
+
+func TestDatetimeColumn(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10, Type: CellTypeDatetime},
+	})
+
+	r := sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeNumber, Value: "1"}
+	r.Cells[1] = Cell{Type: CellTypeNumber, Value: "41993"}
+	sh.AppendRow(r)
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+
+	expected := []string{
+		`<col min="1" max="1" width="10" customWidth="1" style="1"/>`,
+		`<col min="2" max="2" width="10" customWidth="1" style="2"/>`,
+		`<c r="A1" t="n" s="1"><v>1</v></c>`,
+		`<c r="B1" t="n" s="2"><v>41993</v></c>`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(x, e) {
+			t.Errorf("expected %s in %s", e, x)
+		}
+	}
+}
 
-	err = TemplateStyles.Execute(&b, nil)
+func TestFormula(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10},
+		Column{Name: "Col3", Width: 10},
+	})
+
+	r := sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeFormula, Value: "SUM(A2:A10)"}
+	r.Cells[1] = Cell{Type: CellTypeFormula, Value: "=A1*2", Result: "84"}
+	r.Cells[2] = Cell{Type: CellTypeFormula, Value: `IF(A1<0,"<0","&")`, Result: "&"}
+	sh.AppendRow(r)
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+
+	expected := []string{
+		`<c r="A1" s="1"><f>SUM(A2:A10)</f></c>`,
+		`<c r="B1" s="1"><f>A1*2</f><v>84</v></c>`,
+		`<c r="C1" t="str" s="1"><f>IF(A1&lt;0,&#34;&lt;0&#34;,&#34;&amp;&#34;)</f><v>&amp;</v></c>`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(x, e) {
+			t.Errorf("expected %s in %s", e, x)
+		}
+	}
+}
+
+func TestColspan(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10},
+		Column{Name: "Col3", Width: 10},
+	})
+
+	r := sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeInlineString, Value: "Heading", Colspan: 2}
+	r.Cells[2] = Cell{Type: CellTypeInlineString, Value: "Single", Colspan: 1}
+	sh.AppendRow(r)
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `</sheetData><mergeCells count="1"><mergeCell ref="A1:B1"/></mergeCells>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	r = sh.NewRow()
+	r.Cells[1] = Cell{Type: CellTypeInlineString, Value: "Too wide", Colspan: 3}
+	sh.AppendRow(r)
+
+	err := sh.SaveToWriter(ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected an error for a colspan extending beyond the row")
+	}
+}
+
+func TestRowspan(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10},
+		Column{Name: "Col3", Width: 10},
+	})
+
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	sw, err := ww.NewSheetWriter(&sh)
 	if err != nil {
-		t.Errorf("template TemplateStyles failed to Execute returning error %s", err.Error())
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
 	}
 
-	err = TemplateStringLookups.Execute(&b, []string{})
+	// the merges reach into rows written by the next call to WriteRows
+	r := sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeInlineString, Value: "Report", Colspan: 2, Rowspan: 3}
+	r.Cells[2] = Cell{Type: CellTypeInlineString, Value: "Side", Rowspan: 2}
+	err = sw.WriteRows([]Row{r})
 	if err != nil {
-		t.Errorf("template TemplateStringLookups failed to Execute returning error %s", err.Error())
+		t.Fatalf("WriteRows returned error %s", err.Error())
 	}
 
-	sheet := struct {
-		Cols  []Column
-		Rows  []string
-		Start string
-		End   string
-	}{
-		Cols:  []Column{},
-		Rows:  []string{},
-		Start: "A1",
-		End:   "C3",
+	r = sh.NewRow()
+	r.Cells[2] = Cell{Type: CellTypeInlineString, Value: "Overlap", Rowspan: 2}
+	err = sw.WriteRows([]Row{r})
+	if err == nil {
+		t.Errorf("expected an error for overlapping merged cells")
 	}
 
-	err = TemplateSheetStart.Execute(&b, sheet)
+	r = sh.NewRow()
+	err = sw.WriteRows([]Row{r, r})
 	if err != nil {
-		t.Errorf("template TemplateSheetStart failed to Execute returning error %s", err.Error())
+		t.Fatalf("WriteRows returned error %s", err.Error())
 	}
 
-	for i, _ := range sheet.Rows {
-		rb := &bytes.Buffer{}
-		rowString := fmt.Sprintf(`<row r="%d">%s</row>`, uint64(i), rb.String())
-		_, err = io.WriteString(&b, rowString)
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	x := readParts(t, b.Bytes())["xl/worksheets/sheet1.xml"]
+	expected := `<mergeCells count="2"><mergeCell ref="A1:B3"/><mergeCell ref="C1:C2"/></mergeCells>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestStyleGeneral(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10},
+	})
+
+	r := sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeNumber, Value: "1"}
+	r.Cells[1] = Cell{Type: CellTypeNumber, Value: "2", Style: StyleGeneral}
+	sh.AppendRow(r)
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<c r="A1" t="n" s="1"><v>1</v></c><c r="B1" t="n"><v>2</v></c>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestThousandsStyle(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Population", Width: 10}})
+
+	st := sh.NewThousandsStyle()
+	if st != sh.NewThousandsStyle() || st != sh.AddStyle(Style{NumberFormat: "#,##0"}) {
+		t.Errorf("expected the thousands style to be registered once")
+	}
+	sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeNumber, Value: "1234567", Style: st}}})
+
+	var b bytes.Buffer
+	err := sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+	parts := readParts(t, b.Bytes())
+
+	for name, expected := range map[string]string{
+		"xl/styles.xml":            `<xf numFmtId="3" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/></cellXfs>`,
+		"xl/worksheets/sheet1.xml": `<c r="A1" t="n" s="6"><v>1234567</v></c>`,
+	} {
+		if !strings.Contains(parts[name], expected) {
+			t.Errorf("expected %s in %s: %s", expected, name, parts[name])
+		}
+	}
+}
+
+func TestAddStyle(t *testing.T) {
+	c := []Column{Column{Name: "Col1", Width: 10}}
+
+	s1 := NewSheetWithColumns(c)
+	percent := s1.AddStyle(Style{NumberFormat: "0.00%"})
+	if again := s1.AddStyle(Style{NumberFormat: "0.00%"}); again != percent {
+		t.Errorf("expected the same StyleID for an equal style, got %d and %d", percent, again)
+	}
+
+	// the second sheet registers its styles in a different order, which
+	// must map to the same cellXfs entries
+	s2 := NewSheetWithColumns(c)
+	thousands := s2.AddStyle(Style{NumberFormat: "#,##0"})
+	s2.AddStyle(Style{NumberFormat: "0.00%"})
+
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+
+	for _, w := range []struct {
+		sheet *Sheet
+		style StyleID
+	}{{&s1, percent}, {&s2, thousands}, {&s2, s2.AddStyle(Style{NumberFormat: "0.00%"})}} {
+		sw, err := ww.NewSheetWriter(w.sheet)
+		if err != nil {
+			t.Fatalf("NewSheetWriter returned error %s", err.Error())
+		}
+		err = sw.WriteRows([]Row{Row{Cells: []Cell{Cell{Type: CellTypeNumber, Value: "0.5", Style: w.style}}}})
+		if err != nil {
+			t.Fatalf("WriteRows returned error %s", err.Error())
+		}
+	}
+
+	err := ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+
+	expected := map[string]string{
+		"xl/worksheets/sheet1.xml": `<c r="A1" t="n" s="6"><v>0.5</v></c>`,
+		"xl/worksheets/sheet2.xml": `<c r="A1" t="n" s="7"><v>0.5</v></c>`,
+		"xl/worksheets/sheet3.xml": `<c r="A1" t="n" s="6"><v>0.5</v></c>`,
+		"xl/styles.xml":            `<xf numFmtId="10" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/><xf numFmtId="3" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/></cellXfs>`,
+	}
+
+	for name, e := range expected {
+		if !strings.Contains(parts[name], e) {
+			t.Errorf("expected %s in %s, got %s", e, name, parts[name])
+		}
+	}
+
+	if !strings.Contains(parts["xl/styles.xml"], `<cellXfs count="8">`) {
+		t.Errorf("expected 8 cellXfs entries in %s", parts["xl/styles.xml"])
+	}
+
+	r := s1.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeNumber, Value: "1", Style: percent + 1}
+	s1.AppendRow(r)
+
+	err = s1.SaveToWriter(&b)
+	if err == nil {
+		t.Errorf("expected an error for a style not registered with the sheet")
+	}
+}
+
+func TestFontStyle(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	bold := sh.AddStyle(Style{Font: Font{Bold: true}})
+	italic := sh.AddStyle(Style{Font: Font{Italic: true, Size: 10.5, Color: "ff0000", Name: "Courier & Co"}})
+
+	for _, style := range []StyleID{bold, italic} {
+		r := sh.NewRow()
+		r.Cells[0] = Cell{Type: CellTypeInlineString, Value: "Header", Style: style}
+		sh.AppendRow(r)
+	}
+
+	x := savedPart(t, &sh, "xl/styles.xml")
+
+	expected := []string{
+		`<fonts count="5"`,
+		`<font><b/><sz val="11"/><color rgb="FF000000"/><name val="Arial Unicode MS"/></font><font><i/><sz val="10.5"/><color rgb="FFFF0000"/><name val="Courier &amp; Co"/></font></fonts>`,
+		`<xf numFmtId="0" fontId="3" fillId="0" borderId="0" xfId="0" applyFont="1"/>`,
+		`<xf numFmtId="0" fontId="4" fillId="0" borderId="0" xfId="0" applyFont="1"/>`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(x, e) {
+			t.Errorf("expected %s in %s", e, x)
+		}
+	}
+}
+
+func TestColumnNumberFormat(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Amount", Width: 10, NumberFormat: "#,##0.00"},
+		Column{Name: "Share", Width: 10, NumberFormat: "0.00%"},
+		Column{Name: "Date", Width: 10, Type: CellTypeDatetime, NumberFormat: "dd/mm/yyyy"},
+	})
+
+	r := sh.NewRow()
+	r.Cells[0] = TypedCell(1234.5)
+	r.Cells[1] = TypedCell(0.25)
+	r.Cells[2] = TypedCell(time.Date(2014, 3, 7, 0, 0, 0, 0, time.UTC))
+	sh.AppendRow(r)
+
+	var b bytes.Buffer
+	err := sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+
+	expected := map[string][]string{
+		"xl/worksheets/sheet1.xml": []string{
+			`<col min="1" max="1" width="10" customWidth="1" style="6"/>`,
+			`<c r="A1" t="n" s="6"><v>1234.5</v></c><c r="B1" t="n" s="7"><v>0.25</v></c><c r="C1" s="8"><v>41705</v></c>`,
+		},
+		"xl/styles.xml": []string{
+			`<numFmts count="4">`,
+			`<numFmt numFmtId="166" formatCode="dd/mm/yyyy"/></numFmts>`,
+			`<xf numFmtId="4" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/><xf numFmtId="10" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/><xf numFmtId="166" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/></cellXfs>`,
+		},
+	}
+
+	for name, es := range expected {
+		for _, e := range es {
+			if !strings.Contains(parts[name], e) {
+				t.Errorf("expected %s in %s, got %s", e, name, parts[name])
+			}
+		}
+	}
+}
+
+func TestInvalidValues(t *testing.T) {
+	tests := []Cell{
+		Cell{Type: CellTypeNumber, Value: "1 & 2"},
+		Cell{Type: CellTypeNumber, Value: "<1>"},
+		Cell{Type: CellTypeBool, Value: "yes"},
+		Cell{Type: CellTypeDatetime, Value: "7 March 2014"},
+		Cell{Type: CellType(99), Value: "1"},
+	}
+
+	for _, c := range tests {
+		sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+		sh.AppendRow(Row{Cells: []Cell{c}})
+
+		err := sh.SaveToWriter(ioutil.Discard)
+		if err == nil {
+			t.Errorf("expected an error writing %v", c)
+		}
+	}
+}
+
+func TestRowHeight(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	for _, h := range []float64{0, 20, 12.75} {
+		r := sh.NewRow()
+		r.Cells[0] = TypedCell(1)
+		r.Height = h
+		sh.AppendRow(r)
+	}
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+
+	expected := []string{
+		`<row r="1"><c`,
+		`<row r="2" ht="20" customHeight="1"><c`,
+		`<row r="3" ht="12.75" customHeight="1"><c`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(x, e) {
+			t.Errorf("expected %s in %s", e, x)
+		}
+	}
+}
+
+func TestAutoWidth(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Name", Width: 10},
+		Column{Name: "Date", Width: 10},
+		Column{Name: "Empty", Width: 10},
+	})
+	sh.AutoWidth = true
+
+	r := sh.NewRow()
+	r.Cells[0] = TypedCell("Short")
+	r.Cells[1] = TypedCell(time.Date(2014, 3, 7, 0, 0, 0, 0, time.UTC))
+	sh.AppendRow(r)
+
+	r = sh.NewRow()
+	r.Cells[0] = TypedCell("A much longer name & more")
+	sh.AppendRow(r)
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+
+	expected := []string{
+		`<col min="1" max="1" width="27" customWidth="1" style="1"/>`,
+		`<col min="2" max="2" width="18" customWidth="1" style="1"/>`,
+		`<col min="3" max="3" width="10" customWidth="1" style="1"/>`,
+		`<dimension ref="A1:C2"/>`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(x, e) {
+			t.Errorf("expected %s in %s", e, x)
+		}
+	}
+}
+
+func TestFontColor(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Balance", Width: 10}})
+
+	red := sh.AddStyle(Style{Font: Font{Color: "FF0000"}})
+	opaqueRed := sh.AddStyle(Style{Font: Font{Color: "ffff0000"}})
+	sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeNumber, Value: "-5", Style: red}}})
+	sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeNumber, Value: "-6", Style: opaqueRed}}})
+
+	var b bytes.Buffer
+	err := sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+	x := readParts(t, b.Bytes())["xl/styles.xml"]
+
+	expected := `<fonts count="4" x14ac:knownFonts="1">`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected one red font, %s in %s", expected, x)
+	}
+	expected = `<font><sz val="11"/><color rgb="FFFF0000"/><name val="Arial Unicode MS"/></font></fonts>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	sh = NewSheetWithColumns([]Column{Column{Name: "Balance", Width: 10}})
+	bad := sh.AddStyle(Style{Font: Font{Color: "red"}})
+	sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeNumber, Value: "-5", Style: bad}}})
+	err = sh.SaveToWriter(ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected an error for the font colour red")
+	}
+}
+
+func TestAlignment(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	centered := sh.AddStyle(Style{Font: Font{Bold: true}, Alignment: Alignment{Horizontal: "center"}})
+	wrapped := sh.AddStyle(Style{Alignment: Alignment{Vertical: "top", WrapText: true}})
+
+	r := sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeInlineString, Value: "Header", Style: centered}
+	sh.AppendRow(r)
+
+	r = sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeInlineString, Value: "A long description which wraps", Style: wrapped}
+	r.Height = 45
+	sh.AppendRow(r)
+
+	x := savedPart(t, &sh, "xl/styles.xml")
+
+	expected := []string{
+		`<xf numFmtId="0" fontId="3" fillId="0" borderId="0" xfId="0" applyFont="1" applyAlignment="1"><alignment horizontal="center"/></xf>`,
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyAlignment="1"><alignment vertical="top" wrapText="1"/></xf>`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(x, e) {
+			t.Errorf("expected %s in %s", e, x)
+		}
+	}
+
+	invalid := sh.AddStyle(Style{Alignment: Alignment{Horizontal: "middle"}})
+	r = sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeInlineString, Value: "x", Style: invalid}
+	sh.AppendRow(r)
+
+	err := sh.SaveToWriter(ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected an error for the horizontal alignment middle")
+	}
+}
+
+func TestFill(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	red := sh.AddStyle(Style{Fill: "ff0000"})
+	redBold := sh.AddStyle(Style{Fill: "FFFF0000", Font: Font{Bold: true}})
+
+	for _, style := range []StyleID{red, redBold} {
+		r := sh.NewRow()
+		r.Cells[0] = Cell{Type: CellTypeNumber, Value: "-1", Style: style}
+		sh.AppendRow(r)
+	}
+
+	x := savedPart(t, &sh, "xl/styles.xml")
+
+	expected := []string{
+		`<fills count="3">`,
+		`<fill><patternFill patternType="solid"><fgColor rgb="FFFF0000"/><bgColor indexed="64"/></patternFill></fill></fills>`,
+		`<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/>`,
+		`<xf numFmtId="0" fontId="3" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/>`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(x, e) {
+			t.Errorf("expected %s in %s", e, x)
+		}
+	}
+
+	invalid := sh.AddStyle(Style{Fill: "red"})
+	r := sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeNumber, Value: "1", Style: invalid}
+	sh.AppendRow(r)
+
+	err := sh.SaveToWriter(ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected an error for the fill colour red")
+	}
+}
+
+func TestShareInlineStrings(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	sh.ShareInlineStrings = true
+
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	for _, v := range []string{"a & b", "c", "a & b"} {
+		err = sw.WriteRows([]Row{Row{Cells: []Cell{Cell{Type: CellTypeInlineString, Value: v}}}})
+		if err != nil {
+			t.Fatalf("WriteRows returned error %s", err.Error())
+		}
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+
+	expected := map[string]string{
+		"xl/worksheets/sheet1.xml": `<row r="1"><c r="A1" t="s" s="1"><v>0</v></c></row><row r="2"><c r="A2" t="s" s="1"><v>1</v></c></row><row r="3"><c r="A3" t="s" s="1"><v>0</v></c></row>`,
+		"xl/sharedStrings.xml":     `count="3" uniqueCount="2"><si><t>a &amp; b</t></si><si><t>c</t></si></sst>`,
+	}
+
+	for name, e := range expected {
+		if !strings.Contains(parts[name], e) {
+			t.Errorf("expected %s in %s, got %s", e, name, parts[name])
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Share", Width: 10}})
+
+	r := sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypePercent, Value: "0.25"}
+	sh.AppendRow(r)
+
+	var b bytes.Buffer
+	err := sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+
+	expected := map[string]string{
+		"xl/worksheets/sheet1.xml": `<c r="A1" t="n" s="6"><v>0.25</v></c>`,
+		"xl/styles.xml":            `<numFmts count="3">`,
+	}
+
+	for name, e := range expected {
+		if !strings.Contains(parts[name], e) {
+			t.Errorf("expected %s in %s, got %s", e, name, parts[name])
+		}
+	}
+
+	if e := `<xf numFmtId="9" fontId="1"`; !strings.Contains(parts["xl/styles.xml"], e) {
+		t.Errorf("expected %s in %s", e, parts["xl/styles.xml"])
+	}
+
+	read, err := ReadSheet(&b)
+	if err != nil {
+		t.Fatalf("ReadSheet returned error %s", err.Error())
+	}
+
+	if c := read.rows[0].Cells[0]; c.Type != CellTypePercent || c.Value != "0.25" {
+		t.Errorf("expected a percent cell holding 0.25, got %v", c)
+	}
+}
+
+func TestTextColumns(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10},
+	})
+
+	err := sh.SetTextColumns(1)
+	if err != nil {
+		t.Fatalf("SetTextColumns returned error %s", err.Error())
+	}
+
+	r := sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeNumber, Value: "0123"}
+	r.Cells[1] = Cell{Type: CellTypeNumber, Value: "0123"}
+	sh.AppendRow(r)
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+
+	expected := []string{
+		`<col min="2" max="2" width="10" customWidth="1" style="5"/>`,
+		`<c r="A1" t="n" s="1"><v>0123</v></c>`,
+		`<c r="B1" t="inlineStr" s="5"><is><t>0123</t></is></c>`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(x, e) {
+			t.Errorf("expected %s in %s", e, x)
+		}
+	}
+
+	err = sh.SetTextColumns(2)
+	if err == nil {
+		t.Errorf("expected an error for a column outside the sheet")
+	}
+}
+
+func TestTotals(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10},
+	})
+	sh.TotalRow = true
+	sh.TotalColumn = true
+
+	for i := 0; i < 2; i++ {
+		r := sh.NewRow()
+		r.Cells[0] = TypedCell(1)
+		r.Cells[1] = TypedCell(2)
+		sh.AppendRow(r)
+	}
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<row r="1"><c r="A1" t="n" s="1"><v>1</v></c><c r="B1" t="n" s="4"><v>2</v></c></row>` +
+		`<row r="2"><c r="A2" t="n" s="3"><v>1</v></c><c r="B2" t="n" s="3"><v>2</v></c></row>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	// a streamed sheet's total row is written with WriteTotalRow, and its
+	// dates are bold with a border and keep their format
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	_, err := ww.NewSheetWriter(&sh)
+	if err == nil {
+		t.Errorf("expected an error streaming a sheet with TotalRow")
+	}
+
+	sh.TotalRow = false
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+	d := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	err = sw.WriteRows([]Row{Row{Cells: []Cell{TypedCell(1), NewDateCell(d)}}})
+	if err != nil {
+		t.Fatalf("WriteRows returned error %s", err.Error())
+	}
+	err = sw.WriteTotalRow(Row{Cells: []Cell{TypedCell(1), NewDateCell(d)}})
+	if err != nil {
+		t.Fatalf("WriteTotalRow returned error %s", err.Error())
+	}
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+	x = parts["xl/worksheets/sheet1.xml"]
+	expected = `<row r="1"><c r="A1" t="n" s="1"><v>1</v></c><c r="B1" s="6"><v>45352</v></c></row>` +
+		`<row r="2"><c r="A2" t="n" s="3"><v>1</v></c><c r="B2" s="7"><v>45352</v></c></row>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+	x = parts["xl/styles.xml"]
+	expected = `<xf numFmtId="164" fontId="3" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/>` +
+		`<xf numFmtId="164" fontId="3" fillId="0" borderId="1" xfId="0" applyFont="1" applyBorder="1" applyNumberFormat="1"/>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10},
+	})
+
+	r := sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeNumber, Value: "1.5"}
+	r.Cells[1] = Cell{Type: CellTypeString, Value: "Apple"}
+	sh.AppendRow(r)
+
+	errs := sh.Validate()
+	if len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+
+	r = sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeNumber, Value: "abc"}
+	r.Cells[1] = Cell{Type: CellTypeString, Value: "bell\a"}
+	sh.AppendRow(r)
+
+	r = sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeDatetime, Value: "yesterday"}
+	r.Cells[1] = Cell{Type: CellTypeInlineString, Value: strings.Repeat("x", 32768)}
+	sh.AppendRow(r)
+
+	errs = sh.Validate()
+	if len(errs) != 4 {
+		t.Fatalf("expected 4 errors, got %v", errs)
+	}
+
+	for i, ref := range []string{"A2", "B2", "A3", "B3"} {
+		if !strings.HasPrefix(errs[i].Error(), "cell "+ref+":") {
+			t.Errorf("expected an error for %s, got %s", ref, errs[i].Error())
+		}
+	}
+
+	// only finite decimal numbers are written
+	for _, v := range []string{"0x1p3", "1_000", "NaN", "Inf", "-Inf", "1e999"} {
+		for _, typ := range []CellType{CellTypeNumber, CellTypeDatetime} {
+			sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+			sh.AppendRow(Row{Cells: []Cell{Cell{Type: typ, Value: v}}})
+
+			if typ == CellTypeNumber && len(sh.Validate()) != 1 {
+				t.Errorf("expected Validate to report the number %q", v)
+			}
+			err := sh.SaveToWriter(ioutil.Discard)
+			if err == nil {
+				t.Errorf("expected an error writing %q as a cell of type %d", v, typ)
+			}
+		}
+	}
+	for _, v := range []string{"1", "-1.5", "+.5", "2.", "1E-3"} {
+		_, err := parseDecimal(v)
+		if err != nil {
+			t.Errorf("parseDecimal(%q) returned error %s", v, err.Error())
+		}
+	}
+}
+
+func TestFreezePanes(t *testing.T) {
+	tests := []struct {
+		rows, cols  uint64
+		activeCell  string
+		topLeftCell string
+		expected    string
+	}{
+		{1, 0, "", "", `<sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/><selection pane="bottomLeft" activeCell="A2" sqref="A2"/></sheetView>`},
+		{0, 2, "", "", `<sheetView workbookViewId="0"><pane xSplit="2" topLeftCell="C1" activePane="topRight" state="frozen"/><selection pane="topRight" activeCell="C1" sqref="C1"/></sheetView>`},
+		{1, 1, "", "", `<sheetView workbookViewId="0"><pane xSplit="1" ySplit="1" topLeftCell="B2" activePane="bottomRight" state="frozen"/><selection pane="bottomRight" activeCell="B2" sqref="B2"/></sheetView>`},
+		{1, 0, "B5", "A100", `<sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A100" activePane="bottomLeft" state="frozen"/><selection pane="bottomLeft" activeCell="B5" sqref="B5"/></sheetView>`},
+	}
+
+	for _, c := range tests {
+		sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+		sh.FreezeRows = c.rows
+		sh.FreezeCols = c.cols
+		sh.ActiveCell = c.activeCell
+		sh.TopLeftCell = c.topLeftCell
+
+		x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+		if !strings.Contains(x, c.expected) {
+			t.Errorf("expected %s in %s", c.expected, x)
+		}
+	}
+}
+
+// A label column frozen on its own splits the sheet vertically only
+func TestFreezeFirstColumn(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Label", Width: 10}, Column{Name: "Value", Width: 10}})
+	sh.FreezeCols = 1
+	sh.AppendRow(Row{Cells: []Cell{NewStringCell("a"), NewIntCell(1)}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<pane xSplit="1" topLeftCell="B1" activePane="topRight" state="frozen"/><selection pane="topRight" activeCell="B1" sqref="B1"/>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+	if strings.Contains(x, "ySplit") {
+		t.Errorf("expected no ySplit in %s", x)
+	}
+	checkSchemaOrder(t, "xl/worksheets/sheet1.xml", x)
+}
+
+// A TopLeftCell with frozen rows and columns must be in the scrolling pane,
+// and view cells must be single cell references
+func TestFreezeTopLeftCell(t *testing.T) {
+	tests := []struct {
+		topLeftCell, activeCell string
+		valid                   bool
+	}{
+		{"c10", "d12", true},
+		{"B10", "", false},
+		{"C1", "", false},
+		{"C10", "A1:B2", false},
+		{"C10\"/>", "", false},
+		{"$C$10", "", false},
+		{"", "A0", false},
+	}
+
+	for _, c := range tests {
+		sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+		sh.FreezeRows = 2
+		sh.FreezeCols = 2
+		sh.TopLeftCell = c.topLeftCell
+		sh.ActiveCell = c.activeCell
+
+		err := sh.SaveToWriter(ioutil.Discard)
+		if c.valid && err != nil {
+			t.Errorf("top left cell %q and active cell %q returned error %s", c.topLeftCell, c.activeCell, err.Error())
+		}
+		if !c.valid && err == nil {
+			t.Errorf("expected an error for top left cell %q and active cell %q", c.topLeftCell, c.activeCell)
+		}
+	}
+
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	sh.FreezeRows = 2
+	sh.FreezeCols = 2
+	sh.TopLeftCell = "c10"
+	sh.ActiveCell = "d12"
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<pane xSplit="2" ySplit="2" topLeftCell="C10" activePane="bottomRight" state="frozen"/><selection pane="bottomRight" activeCell="D12" sqref="D12"/>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestColumnDefaultType(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Name", Width: 10, DefaultType: CellTypeInlineString},
+		Column{Name: "Count", Width: 10},
+		Column{Name: "Active", Width: 10, DefaultType: CellTypeBool},
+	})
+
+	r := sh.NewRow()
+	for i, expected := range []CellType{CellTypeInlineString, CellTypeNumber, CellTypeBool} {
+		if r.Cells[i].Type != expected {
+			t.Errorf("expected type %d for cell %d, got %d", expected, i, r.Cells[i].Type)
+		}
+	}
+
+	err := sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeInlineString, Value: "007"}, Cell{Value: "7"}, Cell{Type: CellTypeInlineString, Value: "n/a"}}})
+	if err != nil {
+		t.Fatalf("AppendRow returned error %s", err.Error())
+	}
+
+	// unset cells take the default type, and numbers keep theirs
+	err = sh.AppendRow(Row{Cells: []Cell{NewIntCell(5), Cell{}, Cell{Type: CellTypeBool, Value: "1"}}})
+	if err != nil {
+		t.Fatalf("AppendRow returned error %s", err.Error())
+	}
+	err = sh.AppendRow(Row{Cells: []Cell{Cell{}, NewIntCell(1), Cell{Type: CellTypeBool, Value: "0"}}})
+	if err != nil {
+		t.Fatalf("AppendRow returned error %s", err.Error())
+	}
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := []string{
+		`<c r="A1" t="inlineStr"><is><t>007</t></is></c><c r="B1" t="n" s="1"><v>7</v></c><c r="C1" t="inlineStr"><is><t>n/a</t></is></c>`,
+		`<c r="A2" t="n" s="1"><v>5</v></c>`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(x, e) {
+			t.Errorf("expected %s in %s", e, x)
+		}
+	}
+	if sh.rows[2].Cells[0].Type != CellTypeInlineString {
+		t.Errorf("expected an unset cell to have type %d, got %d", CellTypeInlineString, sh.rows[2].Cells[0].Type)
+	}
+}
+
+func TestBuildRow(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Name", Width: 10},
+		Column{Name: "Age", Width: 10},
+	})
+
+	err := sh.BuildRow().Set("Age", NewIntCell(36)).Set("Name", NewStringCell("Ada")).Append()
+	if err != nil {
+		t.Fatalf("Append returned error %s", err.Error())
+	}
+
+	r, err := sh.BuildRow().Set("Name", NewStringCell("Bob")).Set("Height", NewIntCell(180)).Set("Age", NewIntCell(40)).Row()
+	if err == nil {
+		t.Errorf("expected an error for the unknown column Height")
+	}
+	if r.Cells[1].Value != "" {
+		t.Errorf("expected cells set after an error to be ignored, got %s", r.Cells[1].Value)
+	}
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<row r="1"><c r="A1" t="s" s="1"><v>0</v></c><c r="B1" t="n" s="1"><v>36</v></c></row>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestAutoFilter(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	sh.AutoFilter = "a1:a10"
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `</sheetData><autoFilter ref="A1:A10"/></worksheet>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	sh.AutoFilter = "A1:"
+	err := sh.SaveToWriter(ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected an error for the autofilter range A1:")
+	}
+}
+
+func TestApplyReportStyle(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Name"}, Column{Name: "Amount"}})
+	sh.AppendRow(Row{Cells: []Cell{NewStringCell("Ada"), NewIntCell(36)}})
+
+	err := sh.ApplyReportStyle()
+	if err != nil {
+		t.Fatalf("ApplyReportStyle returned error %s", err.Error())
+	}
+	sh.AppendRow(Row{Cells: []Cell{NewStringCell("A much longer name"), NewIntCell(1)}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := []string{
+		`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`,
+		`<col min="1" max="1" width="20" customWidth="1" style="1"/>`,
+		`<row r="1"><c r="A1" t="s" s="6"><v>1</v></c><c r="B1" t="s" s="6"><v>2</v></c></row><row r="2"><c r="A2" t="s" s="1"><v>0</v></c>`,
+		`</sheetData><autoFilter ref="A1:B3"/>`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(x, e) {
+			t.Errorf("expected %s in %s", e, x)
+		}
+	}
+}
+
+// A sheet using the features which add elements to the worksheet XML
+func featureSheet(t *testing.T) Sheet {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}, Column{Name: "Col2", Width: 10}})
+	sh.OutlineSummaryAbove = true
+	sh.TabColor = "FF0000"
+	sh.FreezeRows = 1
+	sh.AutoFilter = "A1:B2"
+	sh.PrintGridLines = true
+	sh.PageSetup = PageSetup{Landscape: true, FitToWidth: 1, Margins: &PageMargins{}}
+	sh.Header = HeaderFooter{Center: "Title"}
+	sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeString, Value: "merged", Colspan: 2}, Cell{}}})
+	sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeNumber, Value: "1"}, Cell{Type: CellTypeNumber, Value: "2"}}})
+
+	err := sh.AddDataValidation(DataValidation{Range: "A2:B2", Type: ValidationWhole, Min: 0, Max: 9})
+	if err != nil {
+		t.Fatalf("AddDataValidation returned error %s", err.Error())
+	}
+
+	err = sh.AddConditionalFormat(ConditionalFormat{Range: "A2:B2", Type: ConditionCellIs, Operator: "greaterThan", Formula1: "1", Style: Style{Fill: "FFC7CE"}})
+	if err != nil {
+		t.Fatalf("AddConditionalFormat returned error %s", err.Error())
+	}
+
+	var p bytes.Buffer
+	err = png.Encode(&p, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sh.AddImage("C1", p.Bytes(), ImagePNG)
+	if err != nil {
+		t.Fatalf("AddImage returned error %s", err.Error())
+	}
+
+	return sh
+}
+
+// Excel repairs a worksheet whose elements are out of the schema's order
+func TestSheetElementOrder(t *testing.T) {
+	sh := featureSheet(t)
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+
+	elements := []string{"<sheetPr>", "<sheetViews>", "<pane ", "<sheetFormatPr ", "<cols>", "<sheetData>", "<autoFilter ", "<mergeCells ", "<conditionalFormatting ", "<dataValidations ", "<printOptions ", "<pageMargins ", "<pageSetup ", "<headerFooter>", "<drawing "}
+	last := -1
+	for _, e := range elements {
+		i := strings.Index(x, e)
+		if i < 0 {
+			t.Fatalf("expected %s in %s", e, x)
+		}
+		if i < last {
+			t.Errorf("expected %s to follow the preceding elements in %s", e, x)
+		}
+		last = i
+	}
+}
+
+// Sequences of child elements in the SpreadsheetML schema, keyed by the
+// parent element
+var schemaSequences = map[string][]string{
+	"worksheet":       []string{"sheetPr", "dimension", "sheetViews", "sheetFormatPr", "cols", "sheetData", "sheetCalcPr", "sheetProtection", "protectedRanges", "scenarios", "autoFilter", "sortState", "dataConsolidate", "customSheetViews", "mergeCells", "phoneticPr", "conditionalFormatting", "dataValidations", "hyperlinks", "printOptions", "pageMargins", "pageSetup", "headerFooter", "rowBreaks", "colBreaks", "customProperties", "cellWatches", "ignoredErrors", "smartTags", "drawing", "legacyDrawing", "legacyDrawingHF", "picture", "oleObjects", "controls", "webPublishItems", "tableParts", "extLst"},
+	"sheetPr":         []string{"tabColor", "outlinePr", "pageSetUpPr"},
+	"sheetView":       []string{"pane", "selection", "pivotSelection", "extLst"},
+	"dataValidation":  []string{"formula1", "formula2"},
+	"workbook":        []string{"fileVersion", "fileSharing", "workbookPr", "workbookProtection", "bookViews", "sheets", "functionGroups", "externalReferences", "definedNames", "calcPr", "oleSize", "customWorkbookViews", "pivotCaches", "smartTagPr", "smartTagTypes", "webPublishing", "fileRecoveryPr", "webPublishObjects", "extLst"},
+	"styleSheet":      []string{"numFmts", "fonts", "fills", "borders", "cellStyleXfs", "cellXfs", "cellStyles", "dxfs", "tableStyles", "colors", "extLst"},
+	"xf":              []string{"alignment", "protection", "extLst"},
+	"oneCellAnchor":   []string{"from", "ext", "pic", "clientData"},
+	"absoluteAnchor":  []string{"pos", "ext", "pic", "clientData"},
+	"pic":             []string{"nvPicPr", "blipFill", "spPr", "style"},
+	"headerFooter":    []string{"oddHeader", "oddFooter", "evenHeader", "evenFooter", "firstHeader", "firstFooter"},
+	"mergeCells":      []string{"mergeCell"},
+	"dataValidations": []string{"dataValidation"},
+	"cfRule":          []string{"formula", "colorScale", "dataBar", "iconSet", "extLst"},
+	"colorScale":      []string{"cfvo", "color"},
+	"dataBar":         []string{"cfvo", "color"},
+	"dxf":             []string{"font", "numFmt", "fill", "alignment", "border", "protection", "extLst"},
+}
+
+// Check that the XML is well formed and that the children of the elements in
+// schemaSequences are in the schema's order
+func checkSchemaOrder(t *testing.T, name, x string) {
+	d := xml.NewDecoder(strings.NewReader(x))
+
+	// position in the sequence of the last child of each open element
+	type open struct {
+		name string
+		last int
+	}
+	var stack []open
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Errorf("%s is not well formed: %s", name, err.Error())
+			return
+		}
+
+		switch e := tok.(type) {
+		case xml.StartElement:
+			if len(stack) > 0 {
+				parent := &stack[len(stack)-1]
+				if seq, ok := schemaSequences[parent.name]; ok {
+					i := -1
+					for j, n := range seq {
+						if n == e.Name.Local {
+							i = j
+						}
+					}
+					if i < 0 {
+						t.Errorf("unexpected element %s in %s of %s", e.Name.Local, parent.name, name)
+					} else if i < parent.last {
+						t.Errorf("element %s is out of order in %s of %s", e.Name.Local, parent.name, name)
+					} else {
+						parent.last = i
+					}
+				}
+			}
+			stack = append(stack, open{e.Name.Local, -1})
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+func TestSchemaOrder(t *testing.T) {
+	sh := featureSheet(t)
+	st := sh.AddStyle(Style{NumberFormat: "0.000", Alignment: Alignment{Horizontal: "center"}})
+	sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeNumber, Value: "1.5", Style: st}}})
+
+	err := sh.RepeatRows(0, 0)
+	if err != nil {
+		t.Fatalf("RepeatRows returned error %s", err.Error())
+	}
+
+	var b bytes.Buffer
+	err = sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+
+	for name, x := range readParts(t, b.Bytes()) {
+		if strings.HasSuffix(name, ".xml") || strings.HasSuffix(name, ".rels") {
+			checkSchemaOrder(t, name, x)
+		}
+	}
+}
+
+func TestPrintOptions(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	if strings.Contains(x, "<printOptions") {
+		t.Errorf("expected no printOptions by default, got %s", x)
+	}
+
+	sh.PrintGridLines = true
+	sh.PrintHeadings = true
+
+	x = savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `</sheetData><printOptions headings="1" gridLines="1"/></worksheet>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestPageSetup(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	if strings.Contains(x, "<pageSetup") || strings.Contains(x, "<pageMargins") || strings.Contains(x, "<sheetPr>") {
+		t.Errorf("expected no page setup by default, got %s", x)
+	}
+
+	sh.PrintGridLines = true
+	sh.PageSetup = PageSetup{
+		Landscape:  true,
+		PaperSize:  9,
+		FitToWidth: 1,
+		Margins:    &PageMargins{0.5, 0.5, 0.75, 0.75, 0.3, 0.3},
+	}
+
+	x = savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+
+	expected := []string{
+		`<sheetPr><pageSetUpPr fitToPage="1"/></sheetPr>`,
+		`<printOptions gridLines="1"/><pageMargins left="0.5" right="0.5" top="0.75" bottom="0.75" header="0.3" footer="0.3"/><pageSetup paperSize="9" fitToWidth="1" fitToHeight="0" orientation="landscape"/></worksheet>`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(x, e) {
+			t.Errorf("expected %s in %s", e, x)
+		}
+	}
+}
+
+func TestHeaderFooter(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	if strings.Contains(x, "<headerFooter>") {
+		t.Errorf("expected no headerFooter by default, got %s", x)
+	}
+
+	sh.Header = HeaderFooter{Center: "Sales && Costs"}
+	sh.Footer = HeaderFooter{Left: "Confidential", Right: "Page &P of &N"}
+
+	x = savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<headerFooter><oddHeader>&amp;CSales &amp;&amp; Costs</oddHeader><oddFooter>&amp;LConfidential&amp;RPage &amp;P of &amp;N</oddFooter></headerFooter></worksheet>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestOmitStyles(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	sh.OmitStyles = true
+
+	r := sh.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeNumber, Value: "1"}
+	sh.AppendRow(r)
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	if strings.Contains(x, ` s="`) || strings.Contains(x, ` style="`) {
+		t.Errorf("expected no style references, got %s", x)
+	}
+
+	x = savedPart(t, &sh, "[Content_Types].xml")
+	if strings.Contains(x, "styles.xml") {
+		t.Errorf("expected no styles override, got %s", x)
+	}
+
+	x = savedPart(t, &sh, "xl/_rels/workbook.xml.rels")
+	if strings.Contains(x, "styles.xml") {
+		t.Errorf("expected no styles relationship, got %s", x)
+	}
+
+	r = sh.NewRow()
+	r.Cells[0] = TypedCell(time.Now())
+	sh.AppendRow(r)
+
+	err := sh.SaveToWriter(ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected an error writing a datetime cell without styles")
+	}
+
+	// the header sheet decides for every sheet of the workbook
+	wb := NewWorkbook()
+	first := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	first.Title = "First"
+	first.OmitStyles = true
+	second := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	second.Title = "Second"
+	r = second.NewRow()
+	r.Cells[0] = Cell{Type: CellTypeNumber, Value: "2"}
+	second.AppendRow(r)
+	wb.AddSheet(&first)
+	wb.AddSheet(&second)
+
+	var b bytes.Buffer
+	err = wb.Save(&b)
+	if err != nil {
+		t.Fatalf("Save returned error %s", err.Error())
+	}
+	x = readParts(t, b.Bytes())["xl/worksheets/sheet2.xml"]
+	if strings.Contains(x, ` s="`) || strings.Contains(x, ` style="`) {
+		t.Errorf("expected no style references in the second sheet, got %s", x)
+	}
+}
+
+func TestWorkbookWriterFromZip(t *testing.T) {
+	var b bytes.Buffer
+	z := zip.NewWriter(&b)
+
+	ww := NewWorkbookWriterFromZip(z)
+	ww.PartHeader = func(h *zip.FileHeader) {
+		h.Method = zip.Store
+	}
+
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	_, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	_, err = z.Create("extra.txt")
+	if err != nil {
+		t.Fatalf("expected zip.Writer to remain open, got %s", err.Error())
+	}
+	z.Close()
+
+	r, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("output is not a valid zip file: %s", err.Error())
+	}
+
+	for _, f := range r.File {
+		if f.Name != "extra.txt" && f.Method != zip.Store {
+			t.Errorf("expected %s to be stored, got method %d", f.Name, f.Method)
+		}
+	}
+}
+
+func TestPrintArea(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	x := savedPart(t, &sh, "xl/workbook.xml")
+	if strings.Contains(x, "<definedNames>") {
+		t.Errorf("expected no definedNames by default, got %s", x)
+	}
+
+	sh.Title = "My Sheet"
+	sh.PrintArea = "A1:F40"
+
+	x = savedPart(t, &sh, "xl/workbook.xml")
+	expected := `<definedName name="_xlnm.Print_Area" localSheetId="0">&#39;My Sheet&#39;!$A$1:$F$40</definedName>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	for _, area := range []string{"A1:", "A1:F40</definedName>", "Sheet1!A1:B2"} {
+		sh.PrintArea = area
+		if errs := sh.Validate(); len(errs) != 1 {
+			t.Errorf("expected Validate to report the print area %q, got %v", area, errs)
+		}
+		err := sh.SaveToWriter(ioutil.Discard)
+		if err == nil {
+			t.Errorf("expected an error for the print area %q", area)
+		}
+	}
+}
+
+// Sheet titles and the defined names which refer to them are escaped
+func TestSheetTitleEscaped(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	sh.Title = "R&D <Q1>"
+	sh.PrintArea = "A1:A10"
+	err := sh.RepeatRows(0, 0)
+	if err != nil {
+		t.Fatalf("RepeatRows returned error %s", err.Error())
+	}
+
+	var b bytes.Buffer
+	err = sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+	parts := readParts(t, b.Bytes())
+
+	expected := map[string][]string{
+		"xl/workbook.xml": []string{
+			`<sheet name="R&amp;D &lt;Q1&gt;" sheetId="1" r:id="rId1"/>`,
+			`<definedName name="_xlnm.Print_Area" localSheetId="0">&#39;R&amp;D &lt;Q1&gt;&#39;!$A$1:$A$10</definedName>`,
+			`<definedName name="_xlnm.Print_Titles" localSheetId="0">&#39;R&amp;D &lt;Q1&gt;&#39;!$1:$1</definedName>`,
+		},
+		"docProps/app.xml": []string{`<vt:lpstr>R&amp;D &lt;Q1&gt;</vt:lpstr>`},
+	}
+	for name, e := range expected {
+		checkSchemaOrder(t, name, parts[name])
+		for _, s := range e {
+			if !strings.Contains(parts[name], s) {
+				t.Errorf("expected %s in %s", s, parts[name])
+			}
+		}
+	}
+}
+
+func TestDataValidation(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	validations := []DataValidation{
+		DataValidation{Range: "a2:a100", Values: []string{"Yes", "No", `"Maybe"`}},
+		DataValidation{Range: "B2", Source: "=$D$1:$D$3", AllowBlank: true},
+		DataValidation{Range: "C2:C100", Type: ValidationWhole, Min: 1, Max: 10},
+		DataValidation{Range: "D2:D100", Type: ValidationDecimal, Min: -0.5, Max: 2.25},
+	}
+	for _, v := range validations {
+		err := sh.AddDataValidation(v)
+		if err != nil {
+			t.Fatalf("AddDataValidation returned error %s", err.Error())
+		}
+	}
+
+	invalid := []DataValidation{
+		DataValidation{Range: "A"},
+		DataValidation{Range: "A1"},
+		DataValidation{Range: "A1", Values: []string{"a,b"}},
+		DataValidation{Range: "A1", Values: []string{strings.Repeat("a", 256)}},
+		DataValidation{Range: "A1", Type: ValidationWhole, Min: 1.5, Max: 2},
+		DataValidation{Range: "A1", Type: ValidationDecimal, Min: 2, Max: 1},
+		DataValidation{Range: "A1", Type: ValidationType(9)},
+	}
+	for _, v := range invalid {
+		if sh.AddDataValidation(v) == nil {
+			t.Errorf("expected an error for the validation %v", v)
+		}
+	}
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<dataValidations count="4">` +
+		`<dataValidation type="list" showErrorMessage="1" sqref="A2:A100"><formula1>&#34;Yes,No,&#34;&#34;Maybe&#34;&#34;&#34;</formula1></dataValidation>` +
+		`<dataValidation type="list" allowBlank="1" showErrorMessage="1" sqref="B2"><formula1>$D$1:$D$3</formula1></dataValidation>` +
+		`<dataValidation type="whole" showErrorMessage="1" sqref="C2:C100"><formula1>1</formula1><formula2>10</formula2></dataValidation>` +
+		`<dataValidation type="decimal" showErrorMessage="1" sqref="D2:D100"><formula1>-0.5</formula1><formula2>2.25</formula2></dataValidation>` +
+		`</dataValidations>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestImages(t *testing.T) {
+	var p, j bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	err := png.Encode(&p, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = jpeg.Encode(&j, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	err = sh.AddImage("B3", p.Bytes(), ImagePNG)
+	if err != nil {
+		t.Fatalf("AddImage returned error %s", err.Error())
+	}
+	err = sh.AddImageAt(10, 20, j.Bytes(), ImageJPEG)
+	if err != nil {
+		t.Fatalf("AddImageAt returned error %s", err.Error())
+	}
+
+	if sh.AddImage("B", p.Bytes(), ImagePNG) == nil {
+		t.Errorf("expected an error for the cell B")
+	}
+	if sh.AddImage("A1", j.Bytes(), ImagePNG) == nil {
+		t.Errorf("expected an error for a JPEG image as PNG")
+	}
+	if sh.AddImageAt(-1, 0, p.Bytes(), ImagePNG) == nil {
+		t.Errorf("expected an error for a negative position")
+	}
+
+	var b bytes.Buffer
+	err = sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+	parts := readParts(t, b.Bytes())
+
+	if parts["xl/media/image1.png"] != p.String() || parts["xl/media/image2.jpeg"] != j.String() {
+		t.Errorf("expected the images to be written to xl/media")
+	}
+
+	expected := map[string][]string{
+		"[Content_Types].xml": []string{
+			`<Default Extension="png" ContentType="image/png"/><Default Extension="jpeg" ContentType="image/jpeg"/>`,
+			`<Override PartName="/xl/drawings/drawing1.xml" ContentType="application/vnd.openxmlformats-officedocument.drawing+xml"/>`,
+		},
+		"xl/worksheets/sheet1.xml": []string{`<drawing r:id="rId1"/></worksheet>`},
+		"xl/worksheets/_rels/sheet1.xml.rels": []string{
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/drawing" Target="../drawings/drawing1.xml"/>`,
+		},
+		"xl/drawings/drawing1.xml": []string{
+			`<xdr:oneCellAnchor><xdr:from><xdr:col>1</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>2</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from><xdr:ext cx="28575" cy="19050"/>`,
+			`<xdr:absoluteAnchor><xdr:pos x="95250" y="190500"/><xdr:ext cx="28575" cy="19050"/>`,
+			`<a:blip r:embed="rId2"/>`,
+		},
+		"xl/drawings/_rels/drawing1.xml.rels": []string{
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="../media/image1.png"/>`,
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="../media/image2.jpeg"/>`,
+		},
+	}
+	for name, strs := range expected {
+		for _, e := range strs {
+			if !strings.Contains(parts[name], e) {
+				t.Errorf("expected %s in %s: %s", e, name, parts[name])
+			}
+		}
+	}
+}
+
+func TestRepeatRows(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	sh.Title = "My Sheet"
+	sh.PrintArea = "A1:A40"
+
+	err := sh.RepeatRows(0, 1)
+	if err != nil {
+		t.Fatalf("RepeatRows returned error %s", err.Error())
+	}
+
+	x := savedPart(t, &sh, "xl/workbook.xml")
+	expected := `<definedName name="_xlnm.Print_Area" localSheetId="0">&#39;My Sheet&#39;!$A$1:$A$40</definedName><definedName name="_xlnm.Print_Titles" localSheetId="0">&#39;My Sheet&#39;!$1:$2</definedName>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	for _, rows := range [][2]int{{-1, 0}, {2, 1}, {0, 1048576}} {
+		if sh.RepeatRows(rows[0], rows[1]) == nil {
+			t.Errorf("expected an error repeating rows %d to %d", rows[0], rows[1])
+		}
+	}
+}
+
+func TestSheetState(t *testing.T) {
+	states := []SheetState{SheetHidden, SheetVisible, SheetVeryHidden}
+
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	for i, state := range states {
+		sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+		sh.Title = fmt.Sprintf("Sheet%d", i+1)
+		sh.State = state
+		_, err := ww.NewSheetWriter(&sh)
+		if err != nil {
+			t.Fatalf("NewSheetWriter returned error %s", err.Error())
+		}
+	}
+	err := ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	x := readParts(t, b.Bytes())["xl/workbook.xml"]
+	for _, expected := range []string{
+		`<workbookView xWindow="480" yWindow="60" windowWidth="18195" windowHeight="8505" firstSheet="1" activeTab="1"/>`,
+		`<sheet name="Sheet1" sheetId="1" state="hidden" r:id="rId1"/>`,
+		`<sheet name="Sheet2" sheetId="2" r:id="rId2"/>`,
+		`<sheet name="Sheet3" sheetId="3" state="veryHidden" r:id="rId3"/>`,
+	} {
+		if !strings.Contains(x, expected) {
+			t.Errorf("expected %s in %s", expected, x)
+		}
+	}
+
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	sh.State = SheetHidden
+	err = sh.SaveToWriter(ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected an error when no sheet is visible")
+	}
+}
+
+func TestAddDefinedName(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+
+	err := ww.AddDefinedName("SalesData", "="+QuoteSheetRef("My Sheet", "$A$1:$A$10"))
+	if err != nil {
+		t.Fatalf("AddDefinedName returned error %s", err.Error())
+	}
+
+	err = ww.AddDefinedName("Greeting", `"a & b"`)
+	if err != nil {
+		t.Fatalf("AddDefinedName returned error %s", err.Error())
+	}
+
+	for _, name := range []string{"salesdata", "A1", "R1C1", "r", "1st", "Bad Name", ""} {
+		if ww.AddDefinedName(name, "1") == nil {
+			t.Errorf("expected an error for the defined name %q", name)
+		}
+	}
+
+	_, err = ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	x := readParts(t, b.Bytes())["xl/workbook.xml"]
+	expected := `<definedNames><definedName name="SalesData">&#39;My Sheet&#39;!$A$1:$A$10</definedName><definedName name="Greeting">&#34;a &amp; b&#34;</definedName></definedNames>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestDimension(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10},
+	})
+
+	for i := 0; i < 3; i++ {
+		r := sh.NewRow()
+		r.Cells[0] = TypedCell(i)
+		r.Cells[1] = TypedCell(i)
+		sh.AppendRow(r)
+	}
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	if !strings.Contains(x, `<dimension ref="A1:B3"/><sheetViews>`) {
+		t.Errorf("expected dimension A1:B3 before sheetViews, got %s", x)
+	}
+}
+
+func TestEmptyDimension(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	if !strings.Contains(x, `<dimension ref="A1"/>`) {
+		t.Errorf("expected dimension A1 for an empty sheet, got %s", x)
+	}
+
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	ww.BackfillDimension = true
+
+	_, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	x = readParts(t, b.Bytes())["xl/worksheets/sheet1.xml"]
+	if !strings.Contains(x, `<dimension ref="A1"/>`) {
+		t.Errorf("expected dimension A1 for an empty streamed sheet, got %s", x)
+	}
+}
+
+func TestBackfillDimension(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlsx-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	ww.BackfillDimension = true
+	ww.TempDir = dir
+
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10},
+	})
+
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	for i := 0; i < 5; i++ {
+		r := sh.NewRow()
+		r.Cells[0] = TypedCell(i)
+		r.Cells[1] = Cell{Type: CellTypeInlineString, Value: "Test"}
+		err = sw.WriteRows([]Row{r})
+		if err != nil {
+			t.Fatalf("WriteRows returned error %s", err.Error())
+		}
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("expected temporary files to be removed, found %d", len(files))
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("output is not a valid zip file: %s", err.Error())
+	}
+
+	for _, f := range z.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		r, _ := f.Open()
+		content, _ := ioutil.ReadAll(r)
+		r.Close()
+
+		x := string(content)
+		if !strings.Contains(x, `<dimension ref="A1:B5"/><sheetViews>`) {
+			t.Errorf("expected dimension A1:B5 before sheetViews, got %s", x)
+		}
+		if !strings.Contains(x, `<row r="5"><c r="A5" t="n" s="1"><v>4</v></c>`) {
+			t.Errorf("expected the spooled rows, got %s", x)
+		}
+		return
+	}
+
+	t.Errorf("sheet1.xml not found in output")
+}
+
+func TestBackfillDimensionShortRows(t *testing.T) {
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	ww.BackfillDimension = true
+
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10},
+		Column{Name: "Col3", Width: 10},
+	})
+
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	err = sw.WriteRows([]Row{Row{Cells: []Cell{TypedCell(1)}}, Row{Cells: []Cell{TypedCell(2)}}})
+	if err != nil {
+		t.Fatalf("WriteRows returned error %s", err.Error())
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	x := readParts(t, b.Bytes())["xl/worksheets/sheet1.xml"]
+	if !strings.Contains(x, `<dimension ref="A1:C2"/>`) {
+		t.Errorf("expected dimension A1:C2 covering the declared columns, got %s", x)
+	}
+}
+
+func TestOmitExtensions(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	if !strings.Contains(x, "x14ac:dyDescent") {
+		t.Errorf("expected x14ac extensions by default, got %s", x)
+	}
+
+	sh.OmitExtensions = true
+
+	for _, part := range []string{"xl/worksheets/sheet1.xml", "xl/styles.xml"} {
+		x = savedPart(t, &sh, part)
+		if strings.Contains(x, "x14ac") || strings.Contains(x, "mc:") {
+			t.Errorf("expected no extensions in %s, got %s", part, x)
+		}
+	}
+}
+
+func TestSaveToFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlsx-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	r := sh.NewRow()
+	r.Cells[0] = TypedCell("Header")
+	sh.AppendRow(r)
+
+	for i := 0; i < 5; i++ {
+		r := sh.NewRow()
+		r.Cells[0] = TypedCell(i)
+		sh.AppendRow(r)
+	}
+
+	filenames, err := sh.SaveToFiles(dir+"/report_%d.xlsx", 2, 1)
+	if err != nil {
+		t.Fatalf("SaveToFiles returned error %s", err.Error())
+	}
+
+	if len(filenames) != 3 {
+		t.Fatalf("expected 3 files, got %v", filenames)
+	}
+
+	for i, f := range filenames {
+		expected := fmt.Sprintf("%s/report_%d.xlsx", dir, i+1)
+		if f != expected {
+			t.Errorf("expected %s, got %s", expected, f)
+		}
+
+		z, err := zip.OpenReader(f)
+		if err != nil {
+			t.Fatalf("%s is not a valid zip file: %s", f, err.Error())
+		}
+		z.Close()
+	}
+
+	_, err = sh.SaveToFiles(dir+"/report_%d.xlsx", 0, 1)
+	if err == nil {
+		t.Errorf("expected an error for zero rows per file")
+	}
+}
+
+func TestUniqueSheetNames(t *testing.T) {
+	ww := NewWorkbookWriter(ioutil.Discard)
+
+	long := strings.Repeat("x", 31)
+	titles := []string{"Data", "data", "Data", "Summary", long, long}
+	expected := []string{"Data", "data2", "Data3", "Summary", long, strings.Repeat("x", 30) + "2"}
+
+	for i, title := range titles {
+		sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+		sh.Title = title
+		_, err := ww.NewSheetWriter(&sh)
+		if err != nil {
+			t.Fatalf("NewSheetWriter returned error %s", err.Error())
+		}
+		if sh.Title != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], sh.Title)
+		}
+	}
+
+	// split sheets are numbered within the maximum length too
+	title := titleWithSuffix("Ünïcödé "+long, " (2)")
+	if title != "Ünïcödé "+strings.Repeat("x", 19)+" (2)" {
+		t.Errorf("expected a title of 31 characters, got %s", title)
+	}
+
+	for _, title := range []string{"", long + "x", "Q1/Q2", "Sales [EU]", "a:b", "Why?", "*", `a\b`} {
+		sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+		sh.Title = title
+		_, err := ww.NewSheetWriter(&sh)
+		if err == nil {
+			t.Errorf("expected an error for the sheet title %q", title)
+		}
+	}
+}
+
+func TestCompressionLevel(t *testing.T) {
+	sizes := make(map[int]int)
+
+	for _, level := range []int{flate.NoCompression, flate.BestSpeed, flate.BestCompression} {
+		var b bytes.Buffer
+		ww := NewWorkbookWriter(&b)
+
+		err := ww.SetCompressionLevel(level)
+		if err != nil {
+			t.Fatalf("SetCompressionLevel returned error %s", err.Error())
+		}
+
+		sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+		sw, err := ww.NewSheetWriter(&sh)
+		if err != nil {
+			t.Fatalf("NewSheetWriter returned error %s", err.Error())
+		}
+
+		for i := 0; i < 1000; i++ {
+			err = sw.WriteRows([]Row{Row{Cells: []Cell{TypedCell(i)}}})
+			if err != nil {
+				t.Fatalf("WriteRows returned error %s", err.Error())
+			}
+		}
+
+		err = ww.Close()
+		if err != nil {
+			t.Fatalf("Close returned error %s", err.Error())
+		}
+
+		z, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+		if err != nil {
+			t.Fatalf("zip.NewReader returned error %s", err.Error())
+		}
+
+		method := zip.Deflate
+		if level == flate.NoCompression {
+			method = zip.Store
+		}
+		for _, f := range z.File {
+			if f.Method != method {
+				t.Errorf("expected method %d for %s at level %d, got %d", method, f.Name, level, f.Method)
+			}
+		}
+
+		readParts(t, b.Bytes())
+		sizes[level] = b.Len()
+	}
+
+	if !(sizes[flate.NoCompression] > sizes[flate.BestSpeed] && sizes[flate.BestSpeed] >= sizes[flate.BestCompression]) {
+		t.Errorf("expected smaller files at higher compression levels, got %v", sizes)
+	}
+
+	err := NewWorkbookWriter(ioutil.Discard).SetCompressionLevel(10)
+	if err == nil {
+		t.Errorf("expected an error for compression level 10")
+	}
+}
+
+func TestStats(t *testing.T) {
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Col1", Width: 10},
+		Column{Name: "Col2", Width: 10},
+	})
+
+	for _, v := range []string{"Apple", "Pear", "Apple"} {
+		r := sh.NewRow()
+		r.Cells[0] = TypedCell(v)
+		r.Cells[1] = TypedCell(1)
+		sh.AppendRow(r)
+	}
+
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	err = sw.WriteRows(sh.rows)
+	if err != nil {
+		t.Fatalf("WriteRows returned error %s", err.Error())
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	stats := ww.Stats()
+
+	if stats.SharedStrings != 2 {
+		t.Errorf("expected 2 shared strings, got %d", stats.SharedStrings)
+	}
+
+	if stats.Cells != 6 {
+		t.Errorf("expected 6 cells, got %d", stats.Cells)
+	}
+
+	if stats.CompressedBytes != int64(b.Len()) {
+		t.Errorf("expected %d compressed bytes, got %d", b.Len(), stats.CompressedBytes)
+	}
+
+	if stats.UncompressedBytes == 0 {
+		t.Errorf("expected uncompressed bytes to be counted")
+	}
+}
+
+func TestMultipleSheets(t *testing.T) {
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+
+	for _, title := range []string{"First", "Second"} {
+		sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+		sh.Title = title
+
+		for _, v := range []string{title, "Shared"} {
+			r := sh.NewRow()
+			r.Cells[0] = TypedCell(v)
+			sh.AppendRow(r)
+		}
+
+		sw, err := ww.NewSheetWriter(&sh)
+		if err != nil {
+			t.Fatalf("NewSheetWriter returned error %s", err.Error())
+		}
+
+		err = sw.WriteRows(sh.rows)
+		if err != nil {
+			t.Fatalf("WriteRows returned error %s", err.Error())
+		}
+	}
+
+	err := ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+
+	expected := map[string][]string{
+		"xl/workbook.xml": []string{
+			`<sheet name="First" sheetId="1" r:id="rId1"/><sheet name="Second" sheetId="2" r:id="rId2"/>`,
+		},
+		"xl/_rels/workbook.xml.rels": []string{
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>`,
+			`<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>`,
+			`<Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`,
+		},
+		"[Content_Types].xml": []string{
+			`<Override PartName="/xl/worksheets/sheet1.xml"`,
+			`<Override PartName="/xl/worksheets/sheet2.xml"`,
+		},
+		"docProps/app.xml": []string{
+			`<vt:vector size="2" baseType="lpstr"><vt:lpstr>First</vt:lpstr><vt:lpstr>Second</vt:lpstr></vt:vector>`,
+		},
+		"xl/sharedStrings.xml": []string{
+			`count="4" uniqueCount="3"><si><t>First</t></si><si><t>Shared</t></si><si><t>Second</t></si>`,
+		},
+		"xl/worksheets/sheet1.xml": []string{
+			`<c r="A1" t="s" s="1"><v>0</v></c>`,
+			`<c r="A2" t="s" s="1"><v>1</v></c>`,
+		},
+		"xl/worksheets/sheet2.xml": []string{
+			`<c r="A1" t="s" s="1"><v>2</v></c>`,
+			`<c r="A2" t="s" s="1"><v>1</v></c>`,
+		},
+	}
+
+	for name, contents := range expected {
+		x, ok := parts[name]
+		if !ok {
+			t.Errorf("part %s not found in output", name)
+			continue
+		}
+		for _, e := range contents {
+			if !strings.Contains(x, e) {
+				t.Errorf("expected %s in %s: %s", e, name, x)
+			}
+		}
+	}
+}
+
+func TestCloseWithoutSheets(t *testing.T) {
+	var b bytes.Buffer
+
+	ww := NewWorkbookWriter(&b)
+	err := ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+
+	for _, name := range []string{"xl/workbook.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("expected %s in the empty workbook", name)
+		}
+	}
+}
+
+func TestWriteStructs(t *testing.T) {
+	type score int
+
+	type record struct {
+		Name    string
+		Score   score     `xlsx:"Points"`
+		Ratio   *float64  `xlsx:"Ratio"`
+		Passed  bool      `xlsx:"Passed"`
+		Date    time.Time `xlsx:"Date"`
+		Comment string    `xlsx:"-"`
+	}
+
+	ratio := 0.5
+	d := time.Date(2014, 3, 7, 0, 0, 0, 0, time.UTC)
+
+	records := []record{
+		record{"Alice", 10, &ratio, true, d, "skipped"},
+		record{"Bob", 7, nil, false, d, "skipped"},
+	}
+
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Name", Width: 10},
+		Column{Name: "Points", Width: 10},
+		Column{Name: "Ratio", Width: 10},
+		Column{Name: "Passed", Width: 10},
+		Column{Name: "Date", Width: 10},
+		Column{Name: "Comment", Width: 10},
+	})
+
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	err = sw.WriteStructs(records)
+	if err != nil {
+		t.Fatalf("WriteStructs returned error %s", err.Error())
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	read, err := ReadSheet(&b)
+	if err != nil {
+		t.Fatalf("ReadSheet returned error %s", err.Error())
+	}
+
+	// the skipped column has no cells, so it is not read
+	expected := [][]interface{}{
+		[]interface{}{"Alice", 10.0, 0.5, true, d},
+		[]interface{}{"Bob", 7.0, nil, false, d},
+	}
+	if len(read.columns) != 5 {
+		t.Errorf("expected 5 columns, got %d", len(read.columns))
+	}
+
+	for y, row := range expected {
+		for x, e := range row {
+			v, err := read.GetCellValue(x, y)
+			if err != nil || v != e {
+				t.Errorf("expected %v at (%d, %d), got %v (%v)", e, x, y, v, err)
+			}
+		}
+	}
+
+	err = sw.WriteStructs([]int{1})
+	if err == nil {
+		t.Errorf("expected an error writing a slice of ints")
+	}
+}
+
+func TestWriteRowsContext(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	ww := NewWorkbookWriter(ioutil.Discard)
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	rows := []Row{Row{Cells: []Cell{TypedCell(1)}}, Row{Cells: []Cell{TypedCell(2)}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err = sw.WriteRowsContext(ctx, rows)
+	if err != nil {
+		t.Fatalf("WriteRowsContext returned error %s", err.Error())
+	}
+
+	cancel()
+
+	err = sw.WriteRowsContext(ctx, rows)
+	if err != context.Canceled {
+		t.Errorf("expected %s, got %v", context.Canceled, err)
+	}
+
+	if sw.RowsWritten() != 2 {
+		t.Errorf("expected 2 rows written, got %d", sw.RowsWritten())
+	}
+}
+
+func TestWriteRow(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	for i := 1; i <= 2; i++ {
+		err = sw.WriteRow(Row{Cells: []Cell{NewIntCell(i)}})
+		if err != nil {
+			t.Fatalf("WriteRow returned error %s", err.Error())
+		}
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	x := readParts(t, b.Bytes())["xl/worksheets/sheet1.xml"]
+	expected := `<sheetData><row r="1"><c r="A1" t="n" s="1"><v>1</v></c></row><row r="2"><c r="A2" t="n" s="1"><v>2</v></c></row></sheetData>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+}
+
+func TestRowsWritten(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	ww := NewWorkbookWriter(ioutil.Discard)
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	if sw.RowsWritten() != 0 {
+		t.Errorf("expected no rows written, got %d", sw.RowsWritten())
+	}
+
+	for _, n := range []int{3, 0, 2} {
+		err = sw.WriteRows(make([]Row, n))
+		if err != nil {
+			t.Fatalf("WriteRows returned error %s", err.Error())
+		}
+	}
+
+	if sw.RowsWritten() != 5 {
+		t.Errorf("expected 5 rows written, got %d", sw.RowsWritten())
+	}
+}
+
+func TestSplitSheets(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	ww := NewWorkbookWriter(ioutil.Discard)
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	err = sw.WriteRows(make([]Row, maxRows+1))
+	if err == nil {
+		t.Errorf("expected an error for rows beyond the row limit")
+	}
+
+	// the sheet's selection and ranges stay with the first sheet
+	sh.Active = true
+	sh.PrintArea = "A1:A10"
+	sh.AutoFilter = "A1:A10"
+
+	var b bytes.Buffer
+	ww = NewWorkbookWriter(&b)
+	ww.SplitSheets = true
+	sw, err = ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	rows := []Row{Row{Cells: []Cell{NewIntCell(1)}}}
+	for i := 0; i < maxRows; i++ {
+		rows = append(rows, Row{})
+	}
+	rows = append(rows, Row{Cells: []Cell{NewIntCell(2)}})
+
+	err = sw.WriteRows(rows[:maxRows-1])
+	if err != nil {
+		t.Fatalf("WriteRows returned error %s", err.Error())
+	}
+	err = sw.WriteRows(rows[maxRows-1:])
+	if err != nil {
+		t.Fatalf("WriteRows returned error %s", err.Error())
+	}
+
+	if sw.RowsWritten() != 2 {
+		t.Errorf("expected 2 rows written to the second sheet, got %d", sw.RowsWritten())
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+
+	expected := `<sheet name="Data" sheetId="1" r:id="rId1"/><sheet name="Data (2)" sheetId="2" r:id="rId2"/></sheets>`
+	if !strings.Contains(parts["xl/workbook.xml"], expected) {
+		t.Errorf("expected %s in %s", expected, parts["xl/workbook.xml"])
+	}
+
+	x := parts["xl/worksheets/sheet1.xml"]
+	expected = fmt.Sprintf(`<row r="%d"></row></sheetData>`, maxRows)
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected the first sheet to end with %s", expected)
+	}
+
+	if !strings.Contains(x, `tabSelected="1"`) || !strings.Contains(x, `<autoFilter ref="A1:A10"/>`) {
+		t.Errorf("expected the first sheet to be selected and filtered")
+	}
+
+	x = parts["xl/worksheets/sheet2.xml"]
+	expected = `<sheetData><row r="1"></row><row r="2"><c r="A2" t="n" s="1"><v>2</v></c></row></sheetData>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+	if strings.Contains(x, `tabSelected="1"`) || strings.Contains(x, "<autoFilter") {
+		t.Errorf("expected the second sheet to be neither selected nor filtered in %s", x)
+	}
+
+	if n := strings.Count(parts["xl/workbook.xml"], "_xlnm.Print_Area"); n != 1 {
+		t.Errorf("expected 1 print area, got %d in %s", n, parts["xl/workbook.xml"])
+	}
+}
+
+// A sheet whose temporary file can not be created is not added to the
+// workbook, which can still be closed
+func TestSpoolFileError(t *testing.T) {
+	ww := NewWorkbookWriter(ioutil.Discard)
+	ww.BackfillDimension = true
+	ww.TempDir = filepath.Join(os.TempDir(), "xlsx-missing-dir", "missing")
+
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	_, err := ww.NewSheetWriter(&sh)
+	if err == nil {
+		t.Fatalf("expected an error creating the temporary file")
+	}
+	if len(ww.sheets) != 0 || ww.sheetWriter != nil {
+		t.Errorf("expected the sheet not to be added to the workbook")
+	}
+
+	ww.BackfillDimension = false
+	err = ww.Close()
+	if err != nil {
+		t.Errorf("Close returned error %s", err.Error())
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	ww := NewWorkbookWriter(ioutil.Discard)
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	if err = ww.WriteHeader(&sh); err != ErrHeaderWritten {
+		t.Errorf("expected %s, got %v", ErrHeaderWritten, err)
+	}
+
+	if err = sw.Close(); err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	if err = sw.Close(); err != ErrSheetClosed {
+		t.Errorf("expected %s, got %v", ErrSheetClosed, err)
+	}
+
+	if err = sw.WriteRows([]Row{sh.NewRow()}); err != ErrSheetClosed {
+		t.Errorf("expected %s, got %v", ErrSheetClosed, err)
+	}
+
+	// closing the workbook after its last sheet is not an error
+	if err = ww.Close(); err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	if err = ww.Close(); err != ErrWorkbookClosed {
+		t.Errorf("expected %s, got %v", ErrWorkbookClosed, err)
+	}
+
+	if _, err = ww.NewSheetWriter(&sh); err != ErrWorkbookClosed {
+		t.Errorf("expected %s, got %v", ErrWorkbookClosed, err)
+	}
+}
+
+func TestColumnsToRows(t *testing.T) {
+	cols := [][]Cell{
+		[]Cell{TypedCell(1), TypedCell(2), TypedCell(3)},
+		[]Cell{TypedCell("a"), TypedCell("b"), TypedCell("c")},
+	}
+
+	rows, err := ColumnsToRows(cols)
+	if err != nil {
+		t.Fatalf("ColumnsToRows returned error %s", err.Error())
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+
+	for i, r := range rows {
+		if len(r.Cells) != 2 || r.Cells[0] != cols[0][i] || r.Cells[1] != cols[1][i] {
+			t.Errorf("row %d was not transposed correctly: %v", i, r.Cells)
+		}
+	}
+
+	cols[1] = cols[1][:2]
+	_, err = ColumnsToRows(cols)
+	if err == nil {
+		t.Errorf("expected an error for columns of differing lengths")
+	}
+}
+
+func TestDocumentProperties(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	sh.DocumentInfo.CreatedBy = "Smith & Sons"
+	sh.DocumentInfo.Title = "Sales <2014>"
+	sh.DocumentInfo.Subject = "Quarterly sales"
+	sh.DocumentInfo.Keywords = "sales, 2014"
+	sh.DocumentInfo.Description = "Sales by region"
+	sh.DocumentInfo.Category = "Reports"
+	sh.DocumentInfo.CreatedAt = time.Date(2014, 3, 7, 13, 30, 0, 0, time.UTC)
+	sh.DocumentInfo.ModifiedAt = sh.DocumentInfo.CreatedAt
+
+	var b bytes.Buffer
+	err := sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+
+	x := readParts(t, b.Bytes())["docProps/core.xml"]
+	for _, expected := range []string{
+		`<dc:title>Sales &lt;2014&gt;</dc:title><dc:subject>Quarterly sales</dc:subject><dc:creator>Smith &amp; Sons</dc:creator>`,
+		`<cp:keywords>sales, 2014</cp:keywords><dc:description>Sales by region</dc:description>`,
+		`<cp:category>Reports</cp:category></cp:coreProperties>`,
+	} {
+		if !strings.Contains(x, expected) {
+			t.Errorf("expected %s in %s", expected, x)
+		}
+	}
+
+	r, err := ReadSheet(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadSheet returned error %s", err.Error())
+	}
+	if !reflect.DeepEqual(r.DocumentInfo, sh.DocumentInfo) {
+		t.Errorf("expected %v read back, got %v", sh.DocumentInfo, r.DocumentInfo)
+	}
+
+	sh.DocumentInfo = DocumentInfo{}
+	x = savedPart(t, &sh, "docProps/core.xml")
+	if strings.Contains(x, "<dc:title>") || strings.Contains(x, "<cp:category>") {
+		t.Errorf("expected no empty properties in %s", x)
+	}
+}
+
+func TestAppProperties(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	x := savedPart(t, &sh, "docProps/app.xml")
+	if !strings.Contains(x, "<Application>github.com/psmithuk/xlsx</Application>") || strings.Contains(x, "<Company>") || strings.Contains(x, "<Manager>") {
+		t.Errorf("expected the default properties in %s", x)
+	}
+
+	sh.DocumentInfo.Company = "Smith & Sons"
+	sh.DocumentInfo.Manager = "J. Smith"
+	sh.DocumentInfo.Application = "Reports 2.1"
+
+	x = savedPart(t, &sh, "docProps/app.xml")
+	for _, expected := range []string{
+		`<Application>Reports 2.1</Application>`,
+		`</TitlesOfParts><Manager>J. Smith</Manager><Company>Smith &amp; Sons</Company><LinksUpToDate>`,
+	} {
+		if !strings.Contains(x, expected) {
+			t.Errorf("expected %s in %s", expected, x)
+		}
+	}
+
+	var b bytes.Buffer
+	err := sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+	r, err := ReadSheet(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadSheet returned error %s", err.Error())
+	}
+	if r.DocumentInfo.Company != "Smith & Sons" || r.DocumentInfo.Manager != "J. Smith" || r.DocumentInfo.Application != "Reports 2.1" {
+		t.Errorf("expected the app properties read back, got %v", r.DocumentInfo)
+	}
+}
+
+func TestReadSheet(t *testing.T) {
+	d := time.Date(2014, 3, 7, 13, 30, 0, 0, time.UTC)
+
+	c := []Column{
+		Column{Name: "Number", Width: 10},
+		Column{Name: "String", Width: 20},
+		Column{Name: "Date", Width: 10, Type: CellTypeDatetime},
+		Column{Name: "Bool", Width: 10},
+	}
+
+	s := NewSheetWithColumns(c)
+	s.Title = "Report"
+
+	r := s.NewRow()
+	r.Cells[0] = TypedCell(1.5)
+	r.Cells[1] = TypedCell("a & b")
+	r.Cells[2] = TypedCell(d)
+	r.Cells[3] = TypedCell(true)
+	s.AppendRow(r)
+
+	// a sparse row, with empty cells omitted from the output
+	r = s.NewRow()
+	r.Cells[1] = Cell{Type: CellTypeInlineString, Value: "<inline>"}
+	s.AppendRow(r)
+
+	var b bytes.Buffer
+	err := s.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+
+	read, err := ReadSheet(&b)
+	if err != nil {
+		t.Fatalf("ReadSheet returned error %s", err.Error())
+	}
+
+	if read.Title != "Report" {
+		t.Errorf("expected title Report, got %s", read.Title)
+	}
+
+	if len(read.columns) != 4 || read.columns[1].Width != 20 {
+		t.Errorf("expected 4 columns with widths, got %v", read.columns)
+	}
+
+	expected := [][]interface{}{
+		[]interface{}{1.5, "a & b", d, true},
+		[]interface{}{nil, "<inline>", nil, nil},
+	}
+
+	if len(read.rows) != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), len(read.rows))
+	}
+
+	for y, row := range expected {
+		for x, e := range row {
+			v, err := read.GetCellValue(x, y)
+			if err != nil {
+				t.Errorf("GetCellValue(%d, %d) returned error %s", x, y, err.Error())
+			}
+			if v != e {
+				t.Errorf("expected %v at (%d, %d), got %v", e, x, y, v)
+			}
+		}
+	}
+}
+
+// Column widths running to the last column of the sheet, as Excel writes
+// them, do not add columns without cells
+func TestReadSheetWideCols(t *testing.T) {
+	parts := map[string]string{
+		"xl/workbook.xml":            `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml":   `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><cols><col min="1" max="1" width="20"/><col min="2" max="16384" width="12" hidden="1"/></cols><sheetData><row r="1"><c r="A1"><v>1</v></c><c r="B1"><v>2</v></c></row></sheetData></worksheet>`,
+	}
+
+	var b bytes.Buffer
+	z := zip.NewWriter(&b)
+	for name, x := range parts {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatalf("Create returned error %s", err.Error())
+		}
+		io.WriteString(w, x)
+	}
+	z.Close()
+
+	read, err := ReadSheet(&b)
+	if err != nil {
+		t.Fatalf("ReadSheet returned error %s", err.Error())
+	}
+
+	if len(read.columns) != 2 {
+		t.Fatalf("expected 2 columns, got %d", len(read.columns))
+	}
+	if read.columns[0].Width != 20 || read.columns[1].Width != 12 || !read.columns[1].Hidden {
+		t.Errorf("expected the widths of the columns with cells, got %v", read.columns)
+	}
+}
+
+func TestDate1904(t *testing.T) {
+	d := time.Date(2014, 3, 7, 0, 0, 0, 0, time.UTC)
+
+	sh := NewSheetWithColumns([]Column{Column{Name: "Date", Width: 10}})
+	sh.Date1904 = true
+
+	r := sh.NewRow()
+	r.Cells[0] = TypedCell(d)
+	sh.AppendRow(r)
+
+	var b bytes.Buffer
+	err := sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+
+	expected := map[string]string{
+		"xl/workbook.xml":          `<workbookPr date1904="1" defaultThemeVersion="124226"/>`,
+		"xl/worksheets/sheet1.xml": `<c r="A1" s="2"><v>40243</v></c>`,
+	}
+
+	for name, e := range expected {
+		if !strings.Contains(parts[name], e) {
+			t.Errorf("expected %s in %s, got %s", e, name, parts[name])
+		}
+	}
+
+	read, err := ReadSheet(&b)
+	if err != nil {
+		t.Fatalf("ReadSheet returned error %s", err.Error())
+	}
+
+	v, err := read.GetCellValue(0, 0)
+	if err != nil || v != d {
+		t.Errorf("expected %s, got %v (%v)", d, v, err)
+	}
+}
+
+func TestOpenForAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlsx-test")
+	if err != nil {
+		t.Fatalf("TempDir returned error %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "report.xlsx")
+
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Name", Width: 10},
+		Column{Name: "Count", Width: 10},
+	})
+	sh.Title = "Report"
+
+	r := sh.NewRow()
+	r.Cells[0] = TypedCell("first")
+	r.Cells[1] = TypedCell(1)
+	sh.AppendRow(r)
+
+	err = sh.SaveToFile(filename)
+	if err != nil {
+		t.Fatalf("SaveToFile returned error %s", err.Error())
+	}
+
+	ww, sw, err := OpenForAppend(filename)
+	if err != nil {
+		t.Fatalf("OpenForAppend returned error %s", err.Error())
+	}
+
+	err = sw.WriteRows([]Row{
+		Row{Cells: []Cell{Cell{Type: CellTypeInlineString, Value: "second"}, TypedCell(2)}},
+		Row{Cells: []Cell{NewStringCell("third"), TypedCell(3)}},
+	})
+	if err != nil {
+		t.Fatalf("WriteRows returned error %s", err.Error())
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	read, err := OpenFile(filename)
+	if err != nil {
+		t.Fatalf("OpenFile returned error %s", err.Error())
+	}
+
+	if read.Title != "Report" {
+		t.Errorf("expected title Report, got %s", read.Title)
+	}
+
+	expected := [][]interface{}{
+		[]interface{}{"first", 1.0},
+		[]interface{}{"second", 2.0},
+		[]interface{}{"third", 3.0},
+	}
+
+	if len(read.rows) != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), len(read.rows))
+	}
+
+	for y, row := range expected {
+		for x, e := range row {
+			v, err := read.GetCellValue(x, y)
+			if err != nil || v != e {
+				t.Errorf("expected %v at (%d, %d), got %v (%v)", e, x, y, v, err)
+			}
+		}
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile returned error %s", err.Error())
+	}
+	x := readParts(t, b)["xl/worksheets/sheet1.xml"]
+	if !strings.Contains(x, `<dimension ref="A1:B3"/>`) {
+		t.Errorf("expected the dimension to cover the appended rows in %s", x)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("expected only the appended file in %s, found %d files", dir, len(files))
+	}
+}
+
+// A workbook with anything which OpenForAppend could not keep is left as it is
+func TestOpenForAppendUnsupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlsx-test")
+	if err != nil {
+		t.Fatalf("TempDir returned error %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	newSheet := func(title string) *Sheet {
+		sh := NewSheetWithColumns([]Column{Column{Name: "Name", Width: 10}, Column{Name: "Count", Width: 10}})
+		sh.Title = title
+		sh.AppendRow(Row{Cells: []Cell{NewStringCell("first"), NewIntCell(1)}})
+		return &sh
+	}
+
+	twoSheets := NewWorkbook()
+	twoSheets.AddSheet(newSheet("One"))
+	twoSheets.AddSheet(newSheet("Two"))
+
+	merged := NewWorkbook()
+	sh := newSheet("Merged")
+	sh.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeInlineString, Value: "both", Colspan: 2}, Cell{}}})
+	merged.AddSheet(sh)
+
+	bold := NewWorkbook()
+	sh = newSheet("Bold")
+	c := NewStringCell("bold")
+	c.Style = sh.AddStyle(Style{Font: Font{Bold: true}})
+	sh.AppendRow(Row{Cells: []Cell{c, NewIntCell(2)}})
+	bold.AddSheet(sh)
+
+	for name, wb := range map[string]*Workbook{"sheets": twoSheets, "merged": merged, "bold": bold} {
+		filename := filepath.Join(dir, name+".xlsx")
+		err = wb.SaveToFile(filename)
+		if err != nil {
+			t.Fatalf("SaveToFile returned error %s", err.Error())
+		}
+		before, _ := ioutil.ReadFile(filename)
+
+		_, _, err = OpenForAppend(filename)
+		if err == nil {
+			t.Errorf("expected an error appending to the %s workbook", name)
+		}
+
+		after, _ := ioutil.ReadFile(filename)
+		if !bytes.Equal(before, after) {
+			t.Errorf("expected the %s workbook to be unchanged", name)
+		}
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 3 {
+		t.Errorf("expected no temporary files to be left, got %d files", len(files))
+	}
+}
+func TestParseCellRef(t *testing.T) {
+
+	tests := []CellIndexTestCase{
+		CellIndexTestCase{0, 0, "A1"},
+		CellIndexTestCase{2, 2, "C3"},
+		CellIndexTestCase{26, 45, "AA46"},
+		CellIndexTestCase{2600, 100000, "CVA100001"},
+		CellIndexTestCase{26, 45, "$AA$46"},
+	}
+
+	for _, c := range tests {
+		x, y, err := parseCellRef(c.expected)
+		if err != nil {
+			t.Errorf("parseCellRef returned error %s", err.Error())
+		}
+		if x != c.x || y != c.y {
+			t.Errorf("expected (%d, %d), got (%d, %d)", c.x, c.y, x, y)
+		}
+	}
+
+	_, _, err := parseCellRef("A0")
+	if err == nil {
+		t.Errorf("expected an error for the cell reference A0")
+	}
+}
+
+func TestTemplates(t *testing.T) {
+
+	var b bytes.Buffer
+	var err error
+	var s Sheet
+	wb := workbookData{&s, []*Sheet{&s}, []definedName{}, 0, 0, []int{1}, []ImageFormat{ImagePNG}, defaultApplication}
+
+	err = TemplateContentTypes.Execute(&b, wb)
+	if err != nil {
+		t.Errorf("template TemplateContentTypes failed to Execute returning error %s", err.Error())
+	}
+
+	err = TemplateRelationships.Execute(&b, nil)
+	if err != nil {
+		t.Errorf("template TemplateRelationships failed to Execute returning error %s", err.Error())
+	}
+
+	err = TemplateApp.Execute(&b, wb)
+	if err != nil {
+		t.Errorf("template TemplateApp failed to Execute returning error %s", err.Error())
+	}
+
+	err = TemplateCore.Execute(&b, s.DocumentInfo)
+	if err != nil {
+		t.Errorf("template TemplateCore failed to Execute returning error %s", err.Error())
+	}
+
+	err = TemplateWorkbook.Execute(&b, wb)
+	if err != nil {
+		t.Errorf("template TemplateWorkbook failed to Execute returning error %s", err.Error())
+	}
+
+	err = TemplateWorkbookRelationships.Execute(&b, wb)
+	if err != nil {
+		t.Errorf("template TemplateWorkbookRelationships failed to Execute returning error %s", err.Error())
+	}
+
+	styles := stylesData{&s, []numFmt{numFmt{166, "0.00%"}}, []Font{Font{Bold: true}.resolved()}, []string{"FFFF0000"}, []xf{xf{166, 3, 0, 1, false, Alignment{}}, xf{0, 1, 2, 0, true, Alignment{"center", "top", true}}}, []Style{Style{Font: Font{Bold: true, Color: "FF9C0006"}, Fill: "FFFFC7CE"}}}
+
+	err = TemplateStyles.Execute(&b, styles)
+	if err != nil {
+		t.Errorf("template TemplateStyles failed to Execute returning error %s", err.Error())
+	}
+
+	sst := struct {
+		Count   int
+		Strings []string
+	}{
+		Count:   0,
+		Strings: []string{},
+	}
+	err = TemplateStringLookups.Execute(&b, sst)
+	if err != nil {
+		t.Errorf("template TemplateStringLookups failed to Execute returning error %s", err.Error())
+	}
+
+	sheet := struct {
+		*Sheet
+		OmitStyles      bool
+		TopLeftCell     string
+		Cols            []columnData
+		Rows            []string
+		Start           string
+		End             string
+		Dimension       string
+		Pane            *paneData
+		Selection       string
+		TabRGB          string
+		OutlineLevelRow uint
+		OutlineLevelCol uint
+	}{
+		Sheet:           &s,
+		Cols:            []columnData{},
+		Rows:            []string{},
+		Start:           "A1",
+		End:             "C3",
+		Dimension:       "A1:C3",
+		Pane:            &paneData{0, 1, "A2", "bottomLeft"},
+		Selection:       "A2",
+		TabRGB:          "FF00B050",
+		OutlineLevelRow: 1,
+		OutlineLevelCol: 1,
+	}
+
+	err = TemplateSheetStart.Execute(&b, sheet)
+	if err != nil {
+		t.Errorf("template TemplateSheetStart failed to Execute returning error %s", err.Error())
+	}
+
+	sheetEnd := struct {
+		*Sheet
+		FilterRange        string
+		MergeCells         []string
+		ConditionalFormats []conditionData
+		DataValidations    []validationData
+		Drawing            bool
+	}{
+		Sheet:       &s,
+		FilterRange: "A1:B1",
+		MergeCells:  []string{"A1:B1"},
+		ConditionalFormats: []conditionData{
+			conditionData{"colorScale", "A2:A9", 1, []string{"FFF8696B", "FFFFEB84", "FF63BE7B"}, "", "", "", 0},
+			conditionData{"dataBar", "B2:B9", 2, []string{"FF638EC6"}, "", "", "", 0},
+			conditionData{"cellIs", "C2:C9", 3, nil, "between", "1", "10", 0},
+		},
+		DataValidations: []validationData{validationData{"whole", "A2", "1", "10", true}},
+		Drawing:         true,
+	}
+
+	err = TemplateSheetEnd.Execute(&b, sheetEnd)
+	if err != nil {
+		t.Errorf("template TemplateSheetEnd failed to Execute returning error %s", err.Error())
+	}
+
+	err = TemplateSheetRelationships.Execute(&b, "../drawings/drawing1.xml")
+	if err != nil {
+		t.Errorf("template TemplateSheetRelationships failed to Execute returning error %s", err.Error())
+	}
+
+	images := []drawingImage{drawingImage{false, 1, 1, 0, 0, 9525, 9525, "image1.png"}, drawingImage{true, 0, 0, 9525, 9525, 9525, 9525, "image2.jpeg"}}
+
+	err = TemplateDrawing.Execute(&b, images)
+	if err != nil {
+		t.Errorf("template TemplateDrawing failed to Execute returning error %s", err.Error())
+	}
+
+	err = TemplateDrawingRelationships.Execute(&b, images)
+	if err != nil {
+		t.Errorf("template TemplateDrawingRelationships failed to Execute returning error %s", err.Error())
+	}
+
+	for i, _ := range sheet.Rows {
+		rb := &bytes.Buffer{}
+		rowString := fmt.Sprintf(`<row r="%d">%s</row>`, uint64(i), rb.String())
+		_, err = io.WriteString(&b, rowString)
+	}
+}
+
+// Number of rows written by each iteration of the benchmarks
+const benchmarkRows = 100000
+
+// Stream rows to a new workbook in each iteration, setting the first cell of
+// each row to its index
+func benchmarkStream(b *testing.B, sh *Sheet, r Row) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		ww := NewWorkbookWriter(ioutil.Discard)
+		sw, err := ww.NewSheetWriter(sh)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for i := 0; i < benchmarkRows; i++ {
+			r.Cells[0].Value = strconv.Itoa(i)
+			err = sw.WriteRow(r)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		err = ww.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteRows(b *testing.B) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "ID", Width: 10},
+		Column{Name: "Amount", Width: 10},
+		Column{Name: "Name", Width: 10},
+	})
+
+	r := Row{Cells: []Cell{NewIntCell(0), NewNumberCell(1.5), Cell{Type: CellTypeInlineString, Value: "Test"}}}
+
+	benchmarkStream(b, &sh, r)
+}
+
+func BenchmarkMixedCellTypes(b *testing.B) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "ID", Width: 10},
+		Column{Name: "Name", Width: 10},
+		Column{Name: "Active", Width: 10},
+		Column{Name: "Created", Width: 10},
+		Column{Name: "Share", Width: 10},
+		Column{Name: "Double", Width: 10},
+		Column{Name: "Notes", Width: 10},
+	})
+
+	r := Row{Cells: []Cell{
+		NewIntCell(0),
+		Cell{Type: CellTypeInlineString, Value: "Fish & Chips"},
+		NewBoolCell(true),
+		NewDateCell(time.Date(2014, 3, 7, 13, 30, 0, 0, time.UTC)),
+		Cell{Type: CellTypePercent, Value: "0.25"},
+		Cell{Type: CellTypeFormula, Value: "=A1*2"},
+		Cell{},
+	}}
+
+	benchmarkStream(b, &sh, r)
+}
+
+func BenchmarkSharedStrings(b *testing.B) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "ID", Width: 10},
+		Column{Name: "Category", Width: 10},
+	})
+
+	for i := 0; i < benchmarkRows; i++ {
+		sh.AppendRow(Row{Cells: []Cell{NewIntCell(i), NewStringCell("Category " + strconv.Itoa(i%1000))}})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		err := sh.SaveToWriter(ioutil.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestFromCSV(t *testing.T) {
+	in := "Name;Amount;Born;Seen;Note\n" +
+		"Ada;1.5;1815-12-10;2024-03-01 09:30:00;\n" +
+		"Bob;;1990-01-02;2024-03-02 00:00:00;007\n" +
+		"Cy;-2;;2024-03-03 18:00:00;x\n"
+
+	sh, err := FromCSV(strings.NewReader(in), CSVOptions{Comma: ';'})
+	if err != nil {
+		t.Fatalf("FromCSV returned error %s", err.Error())
+	}
+
+	types := []CellType{CellTypeString, CellTypeNumber, CellTypeDate, CellTypeDatetime, CellTypeString}
+	for i, expected := range types {
+		if got := sh.columns[i].Type; got != expected {
+			t.Errorf("expected column %d to have type %d, got %d", i, expected, got)
+		}
+	}
+
+	x := savedPart(t, sh, "xl/worksheets/sheet1.xml")
+	for _, expected := range []string{
+		`<c r="B2" t="n" s="1"><v>1.5</v></c>`,
+		`<c r="C2" s="6"><v>-30701</v></c>`,
+		`<c r="D2" s="2"><v>45352.395833</v></c>`,
+		`<c r="B4" t="n" s="1"><v>-2</v></c>`,
+		`<c r="E3" t="s" s="1">`,
+	} {
+		if !strings.Contains(x, expected) {
+			t.Errorf("expected %s in %s", expected, x)
+		}
+	}
+	for _, unexpected := range []string{`r="B3"`, `r="C4"`, `r="E2"`} {
+		if strings.Contains(x, unexpected) {
+			t.Errorf("expected no %s in %s", unexpected, x)
+		}
+	}
+
+	// codes with leading zeros stay text, and numbers keep their digits
+	sh, err = FromCSV(strings.NewReader("Zip,ID\n00501,9007199254740993\n10001,12\n"), CSVOptions{})
+	if err != nil {
+		t.Fatalf("FromCSV returned error %s", err.Error())
+	}
+	if sh.columns[0].Type != CellTypeString || sh.columns[1].Type != CellTypeNumber {
+		t.Errorf("expected a string and a number column, got %d and %d", sh.columns[0].Type, sh.columns[1].Type)
+	}
+	x = savedPart(t, sh, "xl/worksheets/sheet1.xml")
+	expected := `<c r="B2" t="n" s="1"><v>9007199254740993</v></c>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+	if v, _ := sh.GetCellValue(0, 1); v != "00501" {
+		t.Errorf("expected the ZIP code 00501, got %v", v)
+	}
+
+	_, err = FromCSV(strings.NewReader(""), CSVOptions{})
+	if err == nil {
+		t.Error("expected an error for a CSV without a header")
+	}
+
+	_, err = FromCSV(strings.NewReader("a,b\n1\n"), CSVOptions{})
+	if err == nil {
+		t.Error("expected an error for a record with too few fields")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Name"},
+		Column{Name: "Count"},
+		Column{Name: "Seen"},
+		Column{Name: "Born"},
+		Column{Name: "Active"},
+		Column{Name: "Total"},
+	})
+
+	seen := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	born := NewDateCell(time.Date(1815, 12, 10, 0, 0, 0, 0, time.UTC))
+	born.Type = CellTypeDate
+
+	r := sh.NewRow()
+	r.Cells = []Cell{NewStringCell(`Smith, "Ada" & co`), NewIntCell(3), NewDateCell(seen), born, NewBoolCell(true), Cell{Type: CellTypeFormula, Value: "B1*2"}}
+	err := sh.AppendRow(r)
+	if err != nil {
+		t.Fatalf("AppendRow returned error %s", err.Error())
+	}
+	err = sh.AppendRow(sh.NewRow())
+	if err != nil {
+		t.Fatalf("AppendRow returned error %s", err.Error())
+	}
+
+	var b bytes.Buffer
+	err = sh.WriteCSV(&b)
+	if err != nil {
+		t.Fatalf("WriteCSV returned error %s", err.Error())
+	}
+
+	expected := "\"Smith, \"\"Ada\"\" & co\",3,2024-03-01T09:30:00Z,1815-12-10,TRUE,B1*2\n,,,,,\n"
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+
+	// a date cell held as its RFC3339 value, as read by ReadSheet
+	sh.rows[1].Cells[3] = Cell{Type: CellTypeDate, Value: "1815-12-10T00:00:00Z"}
+	b.Reset()
+	err = sh.WriteCSV(&b)
+	if err != nil {
+		t.Fatalf("WriteCSV returned error %s", err.Error())
+	}
+	expected = ",,,1815-12-10,,\n"
+	if !strings.HasSuffix(b.String(), expected) {
+		t.Errorf("expected %q at the end of %q", expected, b.String())
+	}
+
+	sh.rows[1].Cells[0] = Cell{Type: CellTypeString, Value: "99"}
+	err = sh.WriteCSV(&b)
+	if err == nil || !strings.Contains(err.Error(), "A2") {
+		t.Errorf("expected an error for cell A2, got %v", err)
+	}
+}
+
+func TestConditionalFormat(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}, Column{Name: "Col2", Width: 10}})
+	sh.AppendRow(Row{Cells: []Cell{NewIntCell(1), NewIntCell(2)}})
+
+	formats := []ConditionalFormat{
+		ConditionalFormat{Range: "a1:a9", MinColor: "F8696B", MidColor: "FFEB84", MaxColor: "63BE7B"},
+		ConditionalFormat{Range: "B1:B9", MinColor: "FFFFFF", MaxColor: "63BE7B"},
+		ConditionalFormat{Range: "B1:B9", Type: ConditionDataBar, Color: "638EC6"},
+		ConditionalFormat{Range: "A1:B9", Type: ConditionCellIs, Operator: "between", Formula1: "=1", Formula2: "$D$1", Style: Style{Font: Font{Bold: true, Color: "9C0006"}, Fill: "FFC7CE"}},
+		ConditionalFormat{Range: "A1:B9", Type: ConditionCellIs, Operator: "lessThan", Formula1: "0", Formula2: "9", Style: Style{Fill: "FFC7CE"}},
+	}
+	for _, f := range formats {
+		err := sh.AddConditionalFormat(f)
+		if err != nil {
+			t.Fatalf("AddConditionalFormat returned error %s", err.Error())
+		}
+	}
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	for _, expected := range []string{
+		`<conditionalFormatting sqref="A1:A9"><cfRule type="colorScale" priority="1"><colorScale><cfvo type="min"/><cfvo type="percentile" val="50"/><cfvo type="max"/><color rgb="FFF8696B"/><color rgb="FFFFEB84"/><color rgb="FF63BE7B"/></colorScale></cfRule></conditionalFormatting>`,
+		`<cfRule type="colorScale" priority="2"><colorScale><cfvo type="min"/><cfvo type="max"/><color rgb="FFFFFFFF"/><color rgb="FF63BE7B"/></colorScale>`,
+		`<cfRule type="dataBar" priority="3"><dataBar><cfvo type="min"/><cfvo type="max"/><color rgb="FF638EC6"/></dataBar></cfRule>`,
+		`<cfRule type="cellIs" dxfId="0" priority="4" operator="between"><formula>1</formula><formula>$D$1</formula></cfRule>`,
+		`<cfRule type="cellIs" dxfId="1" priority="5" operator="lessThan"><formula>0</formula></cfRule>`,
+	} {
+		if !strings.Contains(x, expected) {
+			t.Errorf("expected %s in %s", expected, x)
+		}
+	}
+
+	x = savedPart(t, &sh, "xl/styles.xml")
+	expected := `<dxfs count="2"><dxf><font><b/><color rgb="FF9C0006"/></font><fill><patternFill><bgColor rgb="FFFFC7CE"/></patternFill></fill></dxf><dxf><fill><patternFill><bgColor rgb="FFFFC7CE"/></patternFill></fill></dxf></dxfs>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	invalid := []ConditionalFormat{
+		ConditionalFormat{Range: "A1:", MinColor: "FFFFFF", MaxColor: "000000"},
+		ConditionalFormat{Range: "A1:A9", MinColor: "FFFFFF"},
+		ConditionalFormat{Range: "A1:A9", MinColor: "FFFFFF", MaxColor: "red"},
+		ConditionalFormat{Range: "A1:A9", Type: ConditionDataBar},
+		ConditionalFormat{Range: "A1:A9", Type: ConditionCellIs, Operator: "above", Formula1: "1"},
+		ConditionalFormat{Range: "A1:A9", Type: ConditionCellIs, Operator: "between", Formula1: "1"},
+		ConditionalFormat{Range: "A1:A9", Type: ConditionCellIs, Operator: "equal", Formula1: "1", Style: Style{Fill: "red"}},
+		ConditionalFormat{Range: "A1:A9", Type: ConditionType(9)},
+	}
+	for _, f := range invalid {
+		if sh.AddConditionalFormat(f) == nil {
+			t.Errorf("expected an error for %+v", f)
+		}
+	}
+}
+
+func TestDefaultColumnWidthAndRowHeight(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<sheetFormatPr defaultRowHeight="15" x14ac:dyDescent="0.25"/>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	sh.DefaultColWidth = 12.5
+	sh.DefaultRowHeight = 20
+
+	x = savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected = `<sheetFormatPr defaultColWidth="12.5" defaultRowHeight="20" customHeight="1" x14ac:dyDescent="0.25"/>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	sh.DefaultRowHeight = -1
+
+	var b bytes.Buffer
+	err := sh.SaveToWriter(&b)
+	if err == nil {
+		t.Error("expected an error for a negative default row height")
+	}
+}
+
+func TestColumnWidthAndHidden(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{
+		Column{Name: "Sized", Width: 12},
+		Column{Name: "Default"},
+		Column{Name: "Helper", Width: 12, Hidden: true},
+		Column{Name: "Hidden", Hidden: true},
+	})
+	sh.AppendRow(Row{Cells: []Cell{NewIntCell(1), NewIntCell(2), NewIntCell(3), NewIntCell(4)}})
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<cols><col min="1" max="1" width="12" customWidth="1" style="1"/><col min="2" max="2" style="1"/><col min="3" max="3" width="12" customWidth="1" hidden="1" style="1"/><col min="4" max="4" hidden="1" style="1"/></cols>`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+
+	var b bytes.Buffer
+	err := sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+
+	read, err := ReadSheet(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadSheet returned error %s", err.Error())
+	}
+	for i, expected := range []bool{false, false, true, true} {
+		if read.columns[i].Hidden != expected {
+			t.Errorf("expected column %d to have Hidden %v", i, expected)
+		}
+	}
+}
+
+func TestRichTextCell(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Status", Width: 20}, Column{Name: "Note", Width: 20}})
+	sh.ShareInlineStrings = true
+
+	c := NewRichTextCell(TextRun{Text: "Status: "}, TextRun{Text: "FAILED & <stopped>", Font: Font{Bold: true, Italic: true, Color: "FF0000", Size: 12, Name: "Arial"}})
+	if c.Value != "Status: FAILED & <stopped>" {
+		t.Errorf("expected the joined text of the runs, got %q", c.Value)
+	}
+
+	err := sh.AppendRow(Row{Cells: []Cell{c, Cell{Type: CellTypeInlineString, Value: "plain"}}})
+	if err != nil {
+		t.Fatalf("AppendRow returned error %s", err.Error())
+	}
+
+	x := savedPart(t, &sh, "xl/worksheets/sheet1.xml")
+	expected := `<c r="A1" t="inlineStr"><is><r><t xml:space="preserve">Status: </t></r><r><rPr><rFont val="Arial"/><b/><i/><color rgb="FFFF0000"/><sz val="12"/></rPr><t xml:space="preserve">FAILED &amp; &lt;stopped&gt;</t></r></is></c><c r="B1" t="s"`
+	if !strings.Contains(x, expected) {
+		t.Errorf("expected %s in %s", expected, x)
+	}
+	checkSchemaOrder(t, "xl/worksheets/sheet1.xml", x)
+
+	got, err := sh.GetCellValue(0, 0)
+	if err != nil || got != c.Value {
+		t.Errorf("expected %q from GetCellValue, got %v (%v)", c.Value, got, err)
+	}
+
+	var b bytes.Buffer
+	err = sh.SaveToWriter(&b)
+	if err != nil {
+		t.Fatalf("SaveToWriter returned error %s", err.Error())
+	}
+	read, err := ReadSheet(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadSheet returned error %s", err.Error())
+	}
+	got, err = read.GetCellValue(0, 0)
+	if err != nil || got != c.Value {
+		t.Errorf("expected %q read back, got %v (%v)", c.Value, got, err)
+	}
+
+	sh = NewSheetWithColumns([]Column{Column{Name: "Status", Width: 20}})
+	sh.AppendRow(Row{Cells: []Cell{NewRichTextCell(TextRun{Text: "x", Font: Font{Color: "red"}})}})
+	err = sh.SaveToWriter(&b)
+	if err == nil || !strings.Contains(err.Error(), "A1") {
+		t.Errorf("expected an error for cell A1, got %v", err)
+	}
+}
+
+func TestWorkbook(t *testing.T) {
+	first := NewSheetWithColumns([]Column{Column{Name: "Name", Width: 10}})
+	first.AppendRow(Row{Cells: []Cell{NewStringCell("shared")}})
+	first.AppendRow(Row{Cells: []Cell{NewStringCell("first")}})
+
+	second := NewSheetWithColumns([]Column{Column{Name: "Name", Width: 10}})
+	second.AppendRow(Row{Cells: []Cell{NewStringCell("second")}})
+	second.AppendRow(Row{Cells: []Cell{NewStringCell("shared")}})
+	bold := second.AddStyle(Style{Font: Font{Bold: true}})
+	second.AppendRow(Row{Cells: []Cell{Cell{Type: CellTypeString, Value: "second", Style: bold}}})
+
+	wb := NewWorkbook()
+	for _, s := range []*Sheet{&first, &second} {
+		err := wb.AddSheet(s)
+		if err != nil {
+			t.Fatalf("AddSheet returned error %s", err.Error())
+		}
+	}
+	if wb.AddSheet(&first) == nil {
+		t.Error("expected an error adding a sheet twice")
+	}
+	if len(wb.Sheets()) != 2 {
+		t.Errorf("expected 2 sheets, got %d", len(wb.Sheets()))
+	}
+
+	var b bytes.Buffer
+	err := wb.Save(&b)
+	if err != nil {
+		t.Fatalf("Save returned error %s", err.Error())
+	}
+	parts := readParts(t, b.Bytes())
+
+	tests := []struct {
+		part     string
+		expected string
+	}{
+		{"xl/sharedStrings.xml", `count="5" uniqueCount="3"><si><t>shared</t></si><si><t>first</t></si><si><t>second</t></si></sst>`},
+		{"xl/worksheets/sheet1.xml", `<c r="A1" t="s" s="1"><v>0</v></c></row><row r="2"><c r="A2" t="s" s="1"><v>1</v></c>`},
+		{"xl/worksheets/sheet2.xml", `<dimension ref="A1:A3"/>`},
+		{"xl/worksheets/sheet2.xml", `<c r="A1" t="s" s="1"><v>2</v></c></row><row r="2"><c r="A2" t="s" s="1"><v>0</v></c></row><row r="3"><c r="A3" t="s" s="6"><v>2</v></c>`},
+		{"xl/workbook.xml", `<sheet name="Data" sheetId="1" r:id="rId1"/><sheet name="Data2" sheetId="2" r:id="rId2"/>`},
+	}
+	for _, c := range tests {
+		if !strings.Contains(parts[c.part], c.expected) {
+			t.Errorf("expected %s in %s: %s", c.expected, c.part, parts[c.part])
+		}
+	}
+
+	b.Reset()
+	err = NewWorkbook().Save(&b)
+	if err != nil {
+		t.Fatalf("Save returned error %s for an empty workbook", err.Error())
+	}
+	if _, ok := readParts(t, b.Bytes())["xl/worksheets/sheet1.xml"]; !ok {
+		t.Error("expected an empty workbook to have a sheet")
+	}
+}
+
+func TestStreamedStringCells(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Fruit", Width: 10}, Column{Name: "Count", Width: 10}})
+	sh.AppendRow(Row{Cells: []Cell{NewStringCell("Apple"), NewIntCell(1)}})
+
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	err = sw.WriteRows(sh.rows)
+	if err != nil {
+		t.Fatalf("WriteRows returned error %s", err.Error())
+	}
+
+	// text written directly, including text which looks like a reference
+	for _, v := range []string{"Pear & Plum", "Apple", "0", "Pear & Plum"} {
+		err = sw.WriteRow(Row{Cells: []Cell{NewStringCell(v), NewIntCell(2)}})
+		if err != nil {
+			t.Fatalf("WriteRow returned error %s", err.Error())
+		}
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+	expected := `count="5" uniqueCount="3"><si><t>Apple</t></si><si><t>Pear &amp; Plum</t></si><si><t>0</t></si></sst>`
+	if !strings.Contains(parts["xl/sharedStrings.xml"], expected) {
+		t.Errorf("expected %s in %s", expected, parts["xl/sharedStrings.xml"])
+	}
+
+	read, err := ReadSheet(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadSheet returned error %s", err.Error())
+	}
+	for i, expected := range []string{"Apple", "Pear & Plum", "Apple", "0", "Pear & Plum"} {
+		got, err := read.GetCellValue(0, i)
+		if err != nil || got != expected {
+			t.Errorf("expected %q in row %d, got %v (%v)", expected, i+1, got, err)
+		}
+	}
+}
+
+// Rows built by several goroutines are appended from one
+func TestAppendRows(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Worker", Width: 10}, Column{Name: "Item", Width: 10}})
+
+	const workers, items = 4, 100
+	buffers := make([][]Row, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < items; i++ {
+				buffers[w] = append(buffers[w], Row{Cells: []Cell{NewStringCell("worker " + strconv.Itoa(w)), NewIntCell(i)}})
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for _, rows := range buffers {
+		err := sh.AppendRows(rows)
+		if err != nil {
+			t.Fatalf("AppendRows returned error %s", err.Error())
+		}
+	}
+
+	if len(sh.rows) != workers*items || len(sh.SharedStrings()) != workers {
+		t.Errorf("expected %d rows and %d shared strings, got %d and %d", workers*items, workers, len(sh.rows), len(sh.SharedStrings()))
+	}
+
+	got, err := sh.GetCellValue(0, items)
+	if err != nil || got != "worker 1" {
+		t.Errorf("expected worker 1 in row %d, got %v (%v)", items+1, got, err)
+	}
+
+	err = sh.AppendRows([]Row{Row{Cells: []Cell{NewStringCell("x"), NewIntCell(1)}}, Row{Cells: []Cell{NewStringCell("short")}}})
+	if err == nil || !strings.Contains(err.Error(), "row 2") {
+		t.Errorf("expected an error for row 2, got %v", err)
+	}
+	if len(sh.rows) != workers*items {
+		t.Errorf("expected no rows to be appended, got %d rows", len(sh.rows))
+	}
+}
+
+// Write a small workbook of one sheet with the WorkbookWriter
+func writeSmallWorkbook(ww *WorkbookWriter, name string) error {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Name", Width: 10}, Column{Name: "Count", Width: 10}})
+	sh.Title = name
+	bold := sh.AddStyle(Style{Font: Font{Bold: true}})
+
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 10; i++ {
+		err = sw.WriteRow(Row{Cells: []Cell{NewStringCell(name), Cell{Type: CellTypeNumber, Value: strconv.Itoa(i), Style: bold}}})
+		if err != nil {
+			return err
+		}
+	}
+
+	return ww.Close()
+}
+
+func TestWorkbookWriterReset(t *testing.T) {
+	var fresh bytes.Buffer
+	ww := NewWorkbookWriter(&fresh)
+	ww.SetCompressionLevel(flate.NoCompression)
+	err := writeSmallWorkbook(ww, "Second")
+	if err != nil {
+		t.Fatalf("writing the workbook returned error %s", err.Error())
+	}
+
+	// a workbook left open, with a temporary file, is discarded
+	var discarded, reused bytes.Buffer
+	ww = NewWorkbookWriter(&discarded)
+	ww.SetCompressionLevel(flate.NoCompression)
+	ww.BackfillDimension = true
+	sh := NewSheetWithColumns([]Column{Column{Name: "Name", Width: 10}})
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+	err = sw.WriteRow(Row{Cells: []Cell{NewStringCell("First")}})
+	if err != nil {
+		t.Fatalf("WriteRow returned error %s", err.Error())
+	}
+	spool := ww.sheetWriter.spool.Name()
+
+	ww.Reset(&reused)
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Errorf("expected the temporary file %s to be removed", spool)
+	}
+
+	ww.BackfillDimension = false
+	err = writeSmallWorkbook(ww, "Second")
+	if err != nil {
+		t.Fatalf("writing the reset workbook returned error %s", err.Error())
+	}
+
+	if !bytes.Equal(fresh.Bytes(), reused.Bytes()) {
+		t.Errorf("expected a reset WorkbookWriter to write the same workbook as a new one")
+	}
+	if ww.Stats().CompressedBytes != int64(reused.Len()) {
+		t.Errorf("expected the stats to count %d bytes, got %d", reused.Len(), ww.Stats().CompressedBytes)
+	}
+}
+
+func BenchmarkSmallWorkbooks(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		err := writeSmallWorkbook(NewWorkbookWriter(ioutil.Discard), "Data")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSmallWorkbooksReset(b *testing.B) {
+	ww := NewWorkbookWriter(ioutil.Discard)
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		ww.Reset(ioutil.Discard)
+		err := writeSmallWorkbook(ww, "Data")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStrictRows(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}, Column{Name: "Col2", Width: 10}})
+	wide := Row{Cells: []Cell{NewIntCell(1), NewIntCell(2), NewIntCell(3)}}
+	full := Row{Cells: []Cell{NewIntCell(1), NewIntCell(2)}}
+
+	// rows of any width are written by default
+	ww := NewWorkbookWriter(ioutil.Discard)
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+	err = sw.WriteRows([]Row{wide, Row{}})
+	if err != nil {
+		t.Errorf("WriteRows returned error %s", err.Error())
+	}
+
+	ww = NewWorkbookWriter(ioutil.Discard)
+	ww.StrictRows = true
+	sw, err = ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+	err = sw.WriteRows([]Row{full, full})
+	if err != nil {
+		t.Fatalf("WriteRows returned error %s", err.Error())
+	}
+
+	err = sw.WriteRows([]Row{full, wide})
+	if err == nil || err.Error() != "row 4 has 3 cells and 2 were expected" {
+		t.Errorf("expected an error for row 4, got %v", err)
+	}
+	if sw.RowsWritten() != 2 {
+		t.Errorf("expected no rows to be written, got %d rows", sw.RowsWritten())
+	}
+
+	err = sw.WriteRow(Row{})
+	if err == nil {
+		t.Error("expected an error for a row without cells")
+	}
+}
+
+// A rejected row leaves the rows before it written and nothing of its own
+func TestWriteRowsAfterRejectedRow(t *testing.T) {
+	sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}, Column{Name: "Col2", Width: 10}})
+
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	sw, err := ww.NewSheetWriter(&sh)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+
+	rejected := [][]Cell{
+		[]Cell{NewIntCell(2), Cell{Type: CellTypeNumber, Value: "x<"}},
+		[]Cell{Cell{Type: CellTypeString, Value: "merged", Colspan: 2}, Cell{Type: CellTypeNumber, Value: "1", Colspan: 2}},
+		[]Cell{Cell{Type: CellTypeNumber, Value: "1", Colspan: 2}, Cell{Type: CellTypeNumber, Value: "x<"}},
+	}
+	for _, cells := range rejected {
+		err = sw.WriteRows([]Row{Row{Cells: []Cell{NewStringCell("kept"), NewIntCell(1)}}, Row{Cells: cells}})
+		if err == nil {
+			t.Fatalf("expected an error for the cells %v", cells)
+		}
+	}
+
+	if sw.RowsWritten() != 3 {
+		t.Errorf("expected 3 rows written, got %d", sw.RowsWritten())
+	}
+
+	err = sw.WriteRow(Row{Cells: []Cell{NewStringCell("after"), NewIntCell(2)}})
+	if err != nil {
+		t.Fatalf("WriteRow returned error %s", err.Error())
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+	x := parts["xl/worksheets/sheet1.xml"]
+	if n := strings.Count(x, "<row "); n != 4 {
+		t.Errorf("expected 4 rows in %s, got %d", x, n)
+	}
+	for _, expected := range []string{`<row r="3">`, `<row r="4"><c r="A4" t="s" s="1"><v>1</v></c>`} {
+		if !strings.Contains(x, expected) {
+			t.Errorf("expected %s in %s", expected, x)
+		}
+	}
+	if strings.Contains(x, "<mergeCell") {
+		t.Errorf("expected no merged cells in %s", x)
+	}
+
+	expected := `count="4" uniqueCount="2"><si><t>kept</t></si><si><t>after</t></si>`
+	if !strings.Contains(parts["xl/sharedStrings.xml"], expected) {
+		t.Errorf("expected %s in %s", expected, parts["xl/sharedStrings.xml"])
+	}
+}
+
+// Drawing parts are numbered by drawing rather than by sheet
+func TestImageOnLaterSheet(t *testing.T) {
+	var p bytes.Buffer
+	err := png.Encode(&p, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	second := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+	err = second.AddImage("A1", p.Bytes(), ImagePNG)
+	if err != nil {
+		t.Fatalf("AddImage returned error %s", err.Error())
+	}
+
+	wb := NewWorkbook()
+	wb.AddSheet(&first)
+	wb.AddSheet(&second)
+
+	var b bytes.Buffer
+	err = wb.Save(&b)
+	if err != nil {
+		t.Fatalf("Save returned error %s", err.Error())
+	}
+	parts := readParts(t, b.Bytes())
+
+	for _, name := range []string{"xl/drawings/drawing1.xml", "xl/drawings/_rels/drawing1.xml.rels", "xl/worksheets/_rels/sheet2.xml.rels"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("expected the part %s", name)
+		}
+	}
+
+	x := parts["[Content_Types].xml"]
+	expected := `<Override PartName="/xl/drawings/drawing1.xml" `
+	if !strings.Contains(x, expected) || strings.Contains(x, "drawing2") {
+		t.Errorf("expected only %s in %s", expected, x)
+	}
+}
+
+func TestAddMetadataSheet(t *testing.T) {
+	data := NewSheetWithColumns([]Column{Column{Name: "Amount", Width: 10}})
+	data.DocumentInfo.Title = "Sales"
+
+	var b bytes.Buffer
+	ww := NewWorkbookWriter(&b)
+	err := ww.WriteHeader(&data)
+	if err != nil {
+		t.Fatalf("WriteHeader returned error %s", err.Error())
+	}
+
+	err = ww.AddMetadataSheet(map[string]string{"Source": "billing & invoicing", "Generated": "2024-03-01T09:30:00Z", "Rows": "1"})
+	if err != nil {
+		t.Fatalf("AddMetadataSheet returned error %s", err.Error())
+	}
+
+	sw, err := ww.NewSheetWriter(&data)
+	if err != nil {
+		t.Fatalf("NewSheetWriter returned error %s", err.Error())
+	}
+	err = sw.WriteRow(Row{Cells: []Cell{NewIntCell(5)}})
+	if err != nil {
+		t.Fatalf("WriteRow returned error %s", err.Error())
+	}
+
+	if ww.AddMetadataSheet(nil) == nil {
+		t.Error("expected an error adding a metadata sheet after another sheet")
+	}
+
+	err = ww.Close()
+	if err != nil {
+		t.Fatalf("Close returned error %s", err.Error())
+	}
+
+	parts := readParts(t, b.Bytes())
+	tests := []struct {
+		part     string
+		expected string
+	}{
+		{"xl/workbook.xml", `<sheet name="About" sheetId="1" r:id="rId1"/><sheet name="Data" sheetId="2" r:id="rId2"/>`},
+		{"xl/worksheets/sheet1.xml", `<dimension ref="A1:B3"/>`},
+		{"xl/worksheets/sheet1.xml", `<row r="1"><c r="A1" t="s" s="6"><v>0</v></c><c r="B1" t="s" s="1"><v>1</v></c></row><row r="2"><c r="A2" t="s" s="6"><v>2</v></c>`},
+		{"xl/sharedStrings.xml", `<si><t>Generated</t></si><si><t>2024-03-01T09:30:00Z</t></si><si><t>Rows</t></si><si><t>1</t></si><si><t>Source</t></si><si><t>billing &amp; invoicing</t></si>`},
+		{"xl/styles.xml", `<font><b/>`},
+		{"docProps/core.xml", `<dc:title>Sales</dc:title>`},
+	}
+	for _, c := range tests {
+		if !strings.Contains(parts[c.part], c.expected) {
+			t.Errorf("expected %s in %s: %s", c.expected, c.part, parts[c.part])
+		}
+	}
+}
+
+func TestActiveSheet(t *testing.T) {
+	save := func(sheets []*Sheet) (map[string]string, error) {
+		var b bytes.Buffer
+		ww := NewWorkbookWriter(&b)
+		for _, sh := range sheets {
+			_, err := ww.NewSheetWriter(sh)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err := ww.Close()
+		if err != nil {
+			return nil, err
+		}
+		return readParts(t, b.Bytes()), nil
+	}
+
+	var sheets []*Sheet
+	for _, title := range []string{"Hidden", "Detail", "Summary", "More"} {
+		sh := NewSheetWithColumns([]Column{Column{Name: "Col1", Width: 10}})
+		sh.Title = title
+		sheets = append(sheets, &sh)
+	}
+	sheets[0].State = SheetHidden
+	sheets[2].Active = true
+
+	parts, err := save(sheets)
+	if err != nil {
+		t.Fatalf("saving returned error %s", err.Error())
+	}
+
+	expected := `windowHeight="8505" firstSheet="1" activeTab="2"/>`
+	if !strings.Contains(parts["xl/workbook.xml"], expected) {
+		t.Errorf("expected %s in %s", expected, parts["xl/workbook.xml"])
+	}
+	for i, selected := range []bool{false, false, true, false} {
+		x := parts[fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)]
+		if strings.Contains(x, `<sheetView tabSelected="1" workbookViewId="0">`) != selected {
+			t.Errorf("expected sheet %d to have tabSelected %v in %s", i+1, selected, x)
+		}
+	}
+
+	sheets[3].Active = true
+	_, err = save(sheets)
+	if err == nil {
+		t.Error("expected an error for two active sheets")
+	}
+
+	sheets[3].Active = false
+	sheets[2].State = SheetHidden
+	_, err = save(sheets)
+	if err == nil {
+		t.Error("expected an error for a hidden active sheet")
 	}
 }